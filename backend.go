@@ -0,0 +1,76 @@
+package deepspeech
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// NativeBackend is the name of the backend running libdeepspeech in process.
+// It is the default when Config.Backend is empty.
+const NativeBackend = "native"
+
+// ErrUnknownBackend is returned by Open when Config.Backend is not registered.
+var ErrUnknownBackend = errors.New("deepspeech: unknown backend")
+
+// BackendFactory creates a Model for modelPath. The external scorer is enabled
+// by Open afterwards through Model.EnableExternalScorer.
+type BackendFactory func(modelPath string, config Config) (model.Model, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]BackendFactory)
+)
+
+func init() {
+	RegisterBackend(NativeBackend, openNative)
+}
+
+// RegisterBackend makes a backend available to Open under name.
+// It panics if factory is nil or name is already registered.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if factory == nil {
+		panic("deepspeech: RegisterBackend factory is nil")
+	}
+	if _, dup := backends[name]; dup {
+		panic("deepspeech: RegisterBackend called twice for backend " + name)
+	}
+	backends[name] = factory
+}
+
+// Backends returns the sorted names of the registered backends.
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func backend(name string) (BackendFactory, error) {
+	if name == "" {
+		name = NativeBackend
+	}
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	factory, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+	}
+	return factory, nil
+}
+
+func openNative(modelPath string, config Config) (model.Model, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+	return newModel(modelPath, config.BeamWidth)
+}
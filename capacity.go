@@ -0,0 +1,189 @@
+package deepspeech
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// CapacityConfig configures a CapacityController. Zero values are replaced by
+// their defaults.
+type CapacityConfig struct {
+	// TargetLoad is the share of CPUs decoding may use. Defaults to 0.8.
+	TargetLoad float64
+	// CPUs is the number of cores available for decoding. Defaults to
+	// runtime.NumCPU().
+	CPUs int
+	// Interval is the time between measurements. Defaults to one second.
+	Interval time.Duration
+	// Smoothing is the weight of a new real-time factor measurement in the
+	// moving average, between 0 and 1. Defaults to 0.3.
+	Smoothing float64
+
+	// MinStreams and MaxStreams bound the admission limit. MinStreams
+	// defaults to 1, a MaxStreams of zero means no upper bound.
+	MinStreams int
+	MaxStreams int
+	// MaxQueue is the admission queue length set along with the limit.
+	MaxQueue int
+
+	// Publish, if not nil, is called with every new Capacity, e.g. to report
+	// it to a load balancer.
+	Publish func(Capacity)
+}
+
+// Capacity is the measured load and recommended capacity of a model.
+type Capacity struct {
+	// RealTimeFactor is the smoothed decode time per second of audio, or zero
+	// before any audio was decoded.
+	RealTimeFactor float64
+	// Load is the decode time per wall time over the last interval divided by
+	// the CPUs, so 1 means all CPUs were busy decoding.
+	Load float64
+	// Streams is the recommended number of concurrent real-time streams,
+	// which is also set as the admission limit. It is zero, meaning no
+	// limit, until audio was decoded if MaxStreams is not set.
+	Streams int
+	// Active is the number of admitted streams and SpeechToText calls.
+	Active int
+	// Available is the number of streams that can still be admitted.
+	Available int
+	Updated   time.Time
+}
+
+// CapacityController measures the real-time factor of a model and adjusts its
+// admission limit so decoding stays under a target CPU load. The limit is for
+// the whole model; a Pool splits it over its instances.
+type CapacityController struct {
+	model  model.Model
+	config CapacityConfig
+
+	// Totals at the previous measurement.
+	audioFed   time.Duration
+	decodeTime time.Duration
+	measured   time.Time
+
+	capacity Capacity
+	mu       sync.Mutex
+}
+
+// NewCapacityController returns a controller for m. Call Run to start it.
+func NewCapacityController(m model.Model, config CapacityConfig) *CapacityController {
+	if config.TargetLoad <= 0 {
+		config.TargetLoad = 0.8
+	}
+	if config.CPUs <= 0 {
+		config.CPUs = runtime.NumCPU()
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.Smoothing <= 0 || config.Smoothing > 1 {
+		config.Smoothing = 0.3
+	}
+	if config.MinStreams <= 0 {
+		config.MinStreams = 1
+	}
+	info := m.Info()
+	return &CapacityController{
+		model:      m,
+		config:     config,
+		audioFed:   info.AudioFed,
+		decodeTime: info.DecodeTime,
+		measured:   time.Now(),
+	}
+}
+
+// Run measures the model every interval and updates its admission limit until
+// ctx is done. It returns ctx.Err(), or the error of setting the limit.
+func (c *CapacityController) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if err := c.update(now); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Capacity returns the latest measurement.
+func (c *CapacityController) Capacity() Capacity {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.capacity
+}
+
+// update takes a measurement at now and applies the new limit.
+func (c *CapacityController) update(now time.Time) error {
+	info := c.model.Info()
+
+	c.mu.Lock()
+	audio := info.AudioFed - c.audioFed
+	decode := info.DecodeTime - c.decodeTime
+	elapsed := now.Sub(c.measured)
+	c.audioFed, c.decodeTime, c.measured = info.AudioFed, info.DecodeTime, now
+	if audio < 0 || decode < 0 || elapsed <= 0 {
+		// The totals were reset, e.g. by a reload; start over.
+		c.mu.Unlock()
+		return nil
+	}
+
+	capacity := c.capacity
+	capacity.Load = float64(decode) / float64(elapsed) / float64(c.config.CPUs)
+	if audio > 0 {
+		rtf := float64(decode) / float64(audio)
+		if capacity.RealTimeFactor == 0 {
+			capacity.RealTimeFactor = rtf
+		} else {
+			capacity.RealTimeFactor += c.config.Smoothing * (rtf - capacity.RealTimeFactor)
+		}
+	}
+	capacity.Streams = c.streams(capacity.RealTimeFactor)
+	c.mu.Unlock()
+
+	if capacity.Streams > 0 {
+		err := c.model.SetAdmission(model.Admission{MaxStreams: capacity.Streams, MaxQueue: c.config.MaxQueue})
+		if err != nil {
+			return err
+		}
+	}
+	capacity.Active = c.model.AdmissionStats().Active
+	capacity.Available = 0
+	if capacity.Streams > capacity.Active {
+		capacity.Available = capacity.Streams - capacity.Active
+	}
+	capacity.Updated = now
+
+	c.mu.Lock()
+	c.capacity = capacity
+	c.mu.Unlock()
+	if c.config.Publish != nil {
+		c.config.Publish(capacity)
+	}
+	return nil
+}
+
+// streams returns the number of real-time streams the target load allows at
+// rtf, or zero while rtf is unknown and no limit is set.
+func (c *CapacityController) streams(rtf float64) int {
+	if rtf <= 0 {
+		return c.config.MaxStreams
+	}
+	n := int(math.Floor(c.config.TargetLoad * float64(c.config.CPUs) / rtf))
+	if n < c.config.MinStreams {
+		n = c.config.MinStreams
+	}
+	if c.config.MaxStreams > 0 && n > c.config.MaxStreams {
+		n = c.config.MaxStreams
+	}
+	return n
+}
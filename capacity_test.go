@@ -0,0 +1,97 @@
+package deepspeech
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/deepspeechtest"
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// totals is a model reporting fixed decode totals.
+type totals struct {
+	model.Model
+	audio, decode time.Duration
+}
+
+func (m *totals) Info() model.Info {
+	info := m.Model.Info()
+	info.AudioFed = m.audio
+	info.DecodeTime = m.decode
+	return info
+}
+
+func TestCapacityController(t *testing.T) {
+	m := &totals{Model: deepspeechtest.New(deepspeechtest.Config{})}
+	var published []Capacity
+	c := NewCapacityController(m, CapacityConfig{
+		TargetLoad: 1,
+		CPUs:       1,
+		MaxQueue:   4,
+		Publish:    func(c Capacity) { published = append(published, c) },
+	})
+
+	s, err := m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One second of audio decoded in 250ms is a real-time factor of 0.25, so
+	// 4 real-time streams fit on one CPU.
+	m.audio, m.decode = time.Second, 250*time.Millisecond
+	if err = c.update(c.measured.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	capacity := c.Capacity()
+	if capacity.RealTimeFactor != 0.25 || capacity.Load != 0.25 {
+		t.Fatalf("unexpected real-time factor %v and load %v", capacity.RealTimeFactor, capacity.Load)
+	}
+	if capacity.Streams != 4 {
+		t.Fatalf("unexpected capacity %d", capacity.Streams)
+	}
+	if capacity.Active != 1 || capacity.Available != 3 {
+		t.Fatalf("unexpected active %d and available %d", capacity.Active, capacity.Available)
+	}
+	stats := m.AdmissionStats()
+	if stats.MaxStreams != 4 || stats.MaxQueue != 4 {
+		t.Fatalf("admission limits not applied: %+v", stats.Admission)
+	}
+	if len(published) != 1 || published[0] != capacity {
+		t.Fatal("capacity was not published")
+	}
+
+	// The next measurement is smoothed.
+	m.audio, m.decode = 2*time.Second, 750*time.Millisecond
+	if err = c.update(c.measured.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if rtf := c.Capacity().RealTimeFactor; rtf <= 0.25 || rtf >= 0.5 {
+		t.Fatalf("unexpected smoothed real-time factor %v", rtf)
+	}
+	_ = s.Free()
+}
+
+func TestCapacityController_Pool(t *testing.T) {
+	p := newTestPool(t, 3)
+	m := &totals{Model: p}
+	c := NewCapacityController(m, CapacityConfig{TargetLoad: 1, CPUs: 1, MaxQueue: 2})
+
+	s, err := p.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.audio, m.decode = time.Second, 250*time.Millisecond
+	if err = c.update(c.measured.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The limit of 4 streams is split over the instances, not applied to each.
+	capacity := c.Capacity()
+	if capacity.Streams != 4 || capacity.Active != 1 || capacity.Available != 3 {
+		t.Fatalf("unexpected capacity %+v", capacity)
+	}
+	if stats := p.AdmissionStats(); stats.MaxStreams != 4 || stats.MaxQueue != 2 {
+		t.Fatalf("unexpected pool limits %+v", stats.Admission)
+	}
+	_ = s.Free()
+}
@@ -0,0 +1,58 @@
+// Command deepspeech-worker serves a model to a subprocess.Model over its
+// stdin and stdout, or over the Unix socket given by -socket:
+//
+//	deepspeech-worker -model deepspeech-0.7.4-models.pbmm [-scorer path]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	ds "github.com/mologix-co/deepspeech-go"
+	"github.com/mologix-co/deepspeech-go/model"
+	"github.com/mologix-co/deepspeech-go/subprocess"
+)
+
+func main() {
+	modelPath := flag.String("model", "", "model file")
+	scorerPath := flag.String("scorer", "", "external scorer file")
+	beamWidth := flag.Uint("beam-width", model.BeamWidth, "beam width")
+	socket := flag.String("socket", "", "Unix socket to connect to instead of stdin and stdout")
+	flag.Parse()
+
+	if err := run(*modelPath, *scorerPath, uint32(*beamWidth), *socket); err != nil {
+		fmt.Fprintln(os.Stderr, "deepspeech-worker:", err)
+		os.Exit(1)
+	}
+}
+
+func run(modelPath, scorerPath string, beamWidth uint32, socket string) error {
+	if modelPath == "" {
+		return fmt.Errorf("-model is required")
+	}
+	opts := []ds.Option{ds.WithBeamWidth(beamWidth)}
+	if scorerPath != "" {
+		opts = append(opts, ds.WithScorer(scorerPath))
+	}
+	m, err := ds.OpenContext(context.Background(), modelPath, opts...)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	var w io.Writer = os.Stdout
+	if socket != "" {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			m.Close()
+			return err
+		}
+		defer conn.Close()
+		r, w = conn, conn
+	}
+	return subprocess.Serve(m, r, w)
+}
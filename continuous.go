@@ -0,0 +1,376 @@
+package deepspeech
+
+import (
+	"context"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// timestep is the duration of a decoder timestep, as in libdeepspeech.
+const timestep = 20 * time.Millisecond
+
+// ContinuousConfig configures a ContinuousStream. Zero values are replaced by
+// their defaults.
+type ContinuousConfig struct {
+	// RecognizerConfig configures the recognizer of every segment. Its
+	// events, with timestamps from the start of the ContinuousStream, are
+	// delivered to OnEvent or Events.
+	RecognizerConfig
+
+	// MaxSegment is the audio after which a segment is finished even without
+	// silence. Defaults to one minute.
+	MaxSegment time.Duration
+	// Silence is the silence after speech that finishes a segment. Defaults
+	// to 500ms.
+	Silence time.Duration
+	// IsSilence reports whether a frame is silent. Defaults to a root mean
+	// square below SilenceLevel, which defaults to 300.
+	IsSilence    func(frame []int16) bool
+	SilenceLevel float64
+	// Overlap is the audio before a MaxSegment cut fed again to the next
+	// segment, so words cut in half are recognized. Words decoded twice are
+	// reported once. Defaults to 500ms.
+	Overlap time.Duration
+}
+
+// ContinuousStream recognizes an unbounded feed by finishing the underlying
+// stream at silence or after MaxSegment and continuing in a new one. Each
+// segment that recognized new words ends with a Final event.
+type ContinuousStream struct {
+	ctx    context.Context
+	model  model.Model
+	config ContinuousConfig
+	events chan Event
+
+	recognizer *Recognizer
+	segment    int
+	// offset is the time of the start of the segment's stream.
+	offset time.Duration
+	// fed is the audio fed, without replays, and segmentFed the audio fed to
+	// the segment, with its replay.
+	fed        int64
+	segmentFed int64
+	// silent is the silence at the end of the segment, speech is set once it
+	// had a frame that was not silent.
+	silent     int64
+	speech     bool
+	maxSegment int64
+	minSilence int64
+	overlap    *ring
+
+	// seamEnd and seamWord are the end and value of the last word reported,
+	// for removing words decoded again from the replayed overlap. lastEnd
+	// keeps timestamps monotonic.
+	seamEnd  time.Duration
+	seamWord string
+	lastEnd  time.Duration
+
+	done bool
+	err  error
+	mu   sync.Mutex
+}
+
+// NewContinuousStream returns a ContinuousStream creating its streams from m.
+// ctx bounds waiting for admission when a segment starts.
+func NewContinuousStream(ctx context.Context, m model.Model, config ContinuousConfig) (*ContinuousStream, error) {
+	config.defaults()
+	if config.MaxSegment <= 0 {
+		config.MaxSegment = time.Minute
+	}
+	if config.Silence <= 0 {
+		config.Silence = 500 * time.Millisecond
+	}
+	if config.SilenceLevel <= 0 {
+		config.SilenceLevel = 300
+	}
+	if config.IsSilence == nil {
+		level := config.SilenceLevel
+		config.IsSilence = func(frame []int16) bool { return rms(frame) < level }
+	}
+	if config.Overlap <= 0 {
+		config.Overlap = 500 * time.Millisecond
+	}
+	c := &ContinuousStream{
+		ctx:        ctx,
+		model:      m,
+		config:     config,
+		maxSegment: durationSamples(config.SampleRate, config.MaxSegment),
+		minSilence: durationSamples(config.SampleRate, config.Silence),
+		overlap:    newRing(int(durationSamples(config.SampleRate, config.Overlap))),
+	}
+	if config.OnEvent == nil {
+		c.events = make(chan Event, config.Buffer)
+	}
+	if err := c.start(nil); err != nil {
+		c.end()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Events returns the channel receiving the events of all segments, closed
+// after the last one. It is nil when OnEvent is set.
+func (c *ContinuousStream) Events() <-chan Event {
+	return c.events
+}
+
+// Feed feeds frame to the current segment, finishing it and starting the next
+// one at silence or when it reached MaxSegment.
+func (c *ContinuousStream) Feed(frame []int16) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		if c.err != nil {
+			return c.err
+		}
+		return os.ErrClosed
+	}
+	if err := c.recognizer.Feed(frame); err != nil {
+		return c.fail(err)
+	}
+	c.overlap.write(frame)
+	c.fed += int64(len(frame))
+	c.segmentFed += int64(len(frame))
+	if c.config.IsSilence(frame) {
+		c.silent += int64(len(frame))
+	} else {
+		c.silent = 0
+		c.speech = true
+	}
+
+	switch {
+	case c.speech && c.silent >= c.minSilence:
+		return c.cut(false)
+	case c.segmentFed >= c.maxSegment:
+		return c.cut(true)
+	}
+	return nil
+}
+
+// Finish finishes the current segment, emitting its Final event, and ends
+// the ContinuousStream.
+func (c *ContinuousStream) Finish() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return os.ErrClosed
+	}
+	if _, err := c.recognizer.Finish(); err != nil {
+		return c.fail(err)
+	}
+	c.end()
+	return nil
+}
+
+// Close frees the current segment without a Final event and closes Events.
+func (c *ContinuousStream) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return nil
+	}
+	c.end()
+	return c.recognizer.Close()
+}
+
+// cut finishes the segment and starts the next, replaying the overlap if
+// replay is set. c.mu must be held.
+func (c *ContinuousStream) cut(replay bool) error {
+	if _, err := c.recognizer.Finish(); err != nil {
+		return c.fail(err)
+	}
+	var overlap []int16
+	if replay {
+		overlap = c.overlap.last()
+	}
+	if err := c.start(overlap); err != nil {
+		return c.fail(err)
+	}
+	return nil
+}
+
+// start starts a segment fed overlap first. Errors after the first segment
+// are reported by an Error event. c.mu must be held.
+func (c *ContinuousStream) start(overlap []int16) error {
+	s, err := c.model.CreateStreamContext(c.ctx)
+	if err != nil {
+		if c.recognizer != nil {
+			c.emit(Event{Type: Error, Err: err, Audio: c.audio(c.fed), Segment: c.segment + 1})
+		}
+		return err
+	}
+	if c.recognizer != nil {
+		c.segment++
+	}
+	c.overlap.reset()
+	c.offset = c.audio(c.fed - int64(len(overlap)))
+	c.segmentFed = int64(len(overlap))
+	c.silent = 0
+	c.speech = false
+
+	config := c.config.RecognizerConfig
+	config.OnEvent = c.handle
+	c.recognizer = NewRecognizer(s, config)
+	if len(overlap) > 0 {
+		if err = c.recognizer.Feed(overlap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handle receives the events of the segment's recognizer, called with c.mu
+// held.
+func (c *ContinuousStream) handle(e Event) {
+	e.Segment = c.segment
+	e.Audio += c.offset
+	switch e.Type {
+	case Partial:
+		e.Stable = model.StableText{
+			Committed: c.words(e.Stable.Committed),
+			Volatile:  c.words(e.Stable.Volatile),
+			Newly:     c.words(e.Stable.Newly),
+		}
+		e.Text = e.Stable.Text()
+	case Final:
+		words := c.words(e.Stable.Committed)
+		if len(words) == 0 {
+			// Nothing but silence or repeated words.
+			return
+		}
+		e.Stable = model.StableText{Committed: words, Newly: c.words(e.Stable.Newly)}
+		e.Text = e.Stable.Text()
+		if e.Hypothesis != nil {
+			hyp := *e.Hypothesis
+			hyp.Text = e.Text
+			hyp.Words = words
+			first, last := words[0], words[len(words)-1]
+			hyp.StartStep, hyp.EndStep = first.StartStep, last.EndStep
+			hyp.StartTime, hyp.EndTime = first.StartTime, last.EndTime
+			hyp.Duration = hyp.EndTime - hyp.StartTime
+			e.Hypothesis = &hyp
+		}
+		c.seamEnd = words[len(words)-1].EndTime
+		c.seamWord = words[len(words)-1].Value
+		c.lastEnd = c.seamEnd
+	}
+	c.emit(e)
+}
+
+// words moves words of the segment to the time of the ContinuousStream and
+// removes those already reported by the previous segment. Each word is
+// decided on its own, so a word committed by a partial stays in the Final
+// event.
+func (c *ContinuousStream) words(words []model.Word) []model.Word {
+	out := make([]model.Word, 0, len(words))
+	steps := int(c.offset / timestep)
+	for _, w := range words {
+		w.StartTime += c.offset
+		w.EndTime += c.offset
+		w.StartStep += steps
+		w.EndStep += steps
+		if c.seamEnd > 0 && (w.EndTime <= c.seamEnd || w.StartTime < c.seamEnd && w.Value == c.seamWord) {
+			continue
+		}
+		if w.StartTime < c.lastEnd {
+			w.StartTime = c.lastEnd
+		}
+		if w.EndTime < w.StartTime {
+			w.EndTime = w.StartTime
+		}
+		w.Duration = w.EndTime - w.StartTime
+		out = append(out, w)
+	}
+	return out
+}
+
+// emit delivers e. c.mu must be held.
+func (c *ContinuousStream) emit(e Event) {
+	if c.config.OnEvent != nil {
+		c.config.OnEvent(e)
+		return
+	}
+	c.events <- e
+}
+
+// fail ends the ContinuousStream after err, reported by an Error event.
+// c.mu must be held.
+func (c *ContinuousStream) fail(err error) error {
+	c.err = err
+	c.end()
+	return err
+}
+
+// end closes Events. c.mu must be held.
+func (c *ContinuousStream) end() {
+	c.done = true
+	if c.events != nil {
+		close(c.events)
+	}
+}
+
+func (c *ContinuousStream) audio(samples int64) time.Duration {
+	return time.Duration(samples) * time.Second / time.Duration(c.config.SampleRate)
+}
+
+func durationSamples(sampleRate int, d time.Duration) int64 {
+	return int64(sampleRate) * int64(d) / int64(time.Second)
+}
+
+func rms(frame []int16) float64 {
+	if len(frame) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, s := range frame {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(frame)))
+}
+
+// ring keeps the last samples fed.
+type ring struct {
+	buf  []int16
+	pos  int
+	full bool
+}
+
+func newRing(size int) *ring {
+	return &ring{buf: make([]int16, size)}
+}
+
+func (r *ring) reset() {
+	r.pos, r.full = 0, false
+}
+
+func (r *ring) write(frame []int16) {
+	if len(r.buf) == 0 {
+		return
+	}
+	if len(frame) >= len(r.buf) {
+		copy(r.buf, frame[len(frame)-len(r.buf):])
+		r.pos, r.full = 0, true
+		return
+	}
+	n := copy(r.buf[r.pos:], frame)
+	if n < len(frame) {
+		copy(r.buf, frame[n:])
+		r.full = true
+	}
+	r.pos = (r.pos + len(frame)) % len(r.buf)
+	if r.pos == 0 {
+		r.full = true
+	}
+}
+
+// last returns a copy of the samples in order.
+func (r *ring) last() []int16 {
+	if !r.full {
+		return append([]int16(nil), r.buf[:r.pos]...)
+	}
+	return append(append([]int16(nil), r.buf[r.pos:]...), r.buf[:r.pos]...)
+}
@@ -0,0 +1,193 @@
+package deepspeech
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mologix-co/deepspeech-go/deepspeechtest"
+)
+
+const frameSamples = 320
+
+// frame returns a 20ms frame recognized as part of the word of frame g, see
+// transcribeFrames.
+func frame(g int) []int16 {
+	f := make([]int16, frameSamples)
+	for i := range f {
+		f[i] = int16(1000 + g)
+	}
+	return f
+}
+
+// transcribeFrames recognizes the word "w<g/10>" starting at every frame g
+// divisible by 10 that was fed with the five frames after it.
+func transcribeFrames(audio []int16) []deepspeechtest.Candidate {
+	var text []string
+	var steps []int
+	frames := len(audio) / frameSamples
+	for i := 0; i+5 <= frames; i++ {
+		g := int(audio[i*frameSamples]) - 1000
+		if audio[i*frameSamples] == 0 || g%10 != 0 {
+			continue
+		}
+		word := fmt.Sprintf("w%d", g/10)
+		if len(text) > 0 {
+			text = append(text, " ")
+			steps = append(steps, i-1)
+		}
+		text = append(text, word)
+		for j := range word {
+			steps = append(steps, i+j)
+		}
+	}
+	return []deepspeechtest.Candidate{{Text: strings.Join(text, ""), Timesteps: steps}}
+}
+
+func TestContinuousStream_Overlap(t *testing.T) {
+	m := deepspeechtest.New(deepspeechtest.Config{}).Transcribe(transcribeFrames)
+	var finals []Event
+	c, err := NewContinuousStream(context.Background(), m, ContinuousConfig{
+		RecognizerConfig: RecognizerConfig{
+			OnEvent: func(e Event) {
+				if e.Type == Final {
+					finals = append(finals, e)
+				}
+			},
+		},
+		MaxSegment: 50 * deepspeechtest.StepDuration,
+		Overlap:    10 * deepspeechtest.StepDuration,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for g := 0; g < 120; g++ {
+		if err = c.Feed(frame(g)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = c.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	var words []string
+	last := -1 * deepspeechtest.StepDuration
+	for i, e := range finals {
+		if e.Segment != i {
+			t.Fatalf("final %d: expected segment %d, got %d", i, i, e.Segment)
+		}
+		for _, w := range e.Hypothesis.Words {
+			if w.StartTime < last {
+				t.Fatalf("timestamps not monotonic at %+v", w)
+			}
+			last = w.EndTime
+			words = append(words, w.Value)
+		}
+	}
+	if got := strings.Join(words, " "); got != "w0 w1 w2 w3 w4 w5 w6 w7 w8 w9 w10 w11" {
+		t.Fatalf("unexpected words %q", got)
+	}
+	if len(finals) != 3 {
+		t.Fatalf("expected 3 segments, got %d", len(finals))
+	}
+	// The word of frame 50 starts one second into the feed.
+	if w := finals[1].Hypothesis.Words[0]; w.Value != "w5" || w.StartStep != 50 {
+		t.Fatalf("unexpected first word of the second segment %+v", w)
+	}
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContinuousStream_Silence(t *testing.T) {
+	m := deepspeechtest.New(deepspeechtest.Config{}).Transcribe(transcribeFrames)
+	c, err := NewContinuousStream(context.Background(), m, ContinuousConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := 0
+	feed := func(frames int, silent bool) {
+		for i := 0; i < frames; i, g = i+1, g+1 {
+			f := frame(g)
+			if silent {
+				f = make([]int16, frameSamples)
+			}
+			if err := c.Feed(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	go func() {
+		feed(20, false)
+		feed(30, true)
+		feed(20, false)
+		if err := c.Finish(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var finals []string
+	for e := range c.Events() {
+		if e.Type == Final {
+			finals = append(finals, fmt.Sprintf("%d:%s", e.Segment, e.Text))
+		}
+	}
+	if got := strings.Join(finals, ","); got != "0:w0 w1,1:w5 w6" {
+		t.Fatalf("unexpected finals %q", got)
+	}
+	if m.OpenStreams() != 0 {
+		t.Fatalf("expected all streams finished, got %d open", m.OpenStreams())
+	}
+}
+
+func TestContinuousStream_FinalHypothesis(t *testing.T) {
+	m := deepspeechtest.New(deepspeechtest.Config{}).Transcribe(func(audio []int16) []deepspeechtest.Candidate {
+		if len(audio) <= 50*frameSamples {
+			return []deepspeechtest.Candidate{{Text: "the cat"}}
+		}
+		return []deepspeechtest.Candidate{{Text: "the cap sat"}}
+	})
+	var committed []string
+	var finals []Event
+	c, err := NewContinuousStream(context.Background(), m, ContinuousConfig{
+		RecognizerConfig: RecognizerConfig{
+			OnEvent: func(e Event) {
+				switch e.Type {
+				case Partial:
+					committed = append(committed, e.Stable.CommittedText())
+				case Final:
+					finals = append(finals, e)
+				}
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for g := 0; g < 51; g++ {
+		if err = c.Feed(frame(1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = c.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	// "the cat" was committed by the partials, so the final hypothesis
+	// changing it to "cap" only adds "sat".
+	if len(finals) != 1 || finals[0].Text != "the cat sat" || finals[0].Stable.CommittedText() != "the cat sat" {
+		t.Fatalf("unexpected finals %+v", finals)
+	}
+	if words := finals[0].Hypothesis.Words; len(words) != 3 || words[1].Value != "cat" {
+		t.Fatalf("unexpected final words %+v", words)
+	}
+	if len(committed) == 0 || committed[len(committed)-1] != "the cat" {
+		t.Fatalf("expected \"the cat\" committed by the partials, got %q", committed)
+	}
+	for _, text := range committed {
+		if !strings.HasPrefix(finals[0].Text, text) {
+			t.Fatalf("committed %q retracted by final %q", text, finals[0].Text)
+		}
+	}
+}
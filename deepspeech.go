@@ -1,8 +1,9 @@
 package deepspeech
 
 import (
+	"context"
+
 	"github.com/mologix-co/deepspeech-go/model"
-	"plugin"
 )
 
 const (
@@ -12,12 +13,14 @@ const (
 )
 
 var (
-	lib      *plugin.Plugin
 	newModel func(string, uint32) (model.Model, error)
-	version  string
+	version  = notLoaded
 )
 
 type Config struct {
+	// Backend is the name of a registered backend. Defaults to NativeBackend.
+	Backend string
+
 	BeamWidth uint32
 	LMAlpha   float32
 	LMBeta    float32
@@ -32,43 +35,17 @@ type Hypothesis model.Hypothesis
 type HypothesisCandidate model.HypothesisCandidate
 type Word model.Word
 
+// Version returns the version of the loaded libdeepspeech, or "not loaded".
 func Version() string {
+	loadMu.Lock()
+	defer loadMu.Unlock()
 	return version
 }
 
-func init() {
-	load()
-
-	// Extract.
-	var err error
-	lib, err = plugin.Open("deepspeech_plugin.so")
-	if err != nil {
-		panic(err)
-	}
-
-	symbol, err := lib.Lookup("New")
-	if err != nil {
-		panic(err)
-	}
-
-	var ok bool
-	newModel, ok = symbol.(func(string, uint32) (model.Model, error))
-	if !ok {
-		panic("deepspeech.New does not match signature func(string, uint32) (Model, error)")
-	}
-
-	symbol, err = lib.Lookup("Version")
-	if err != nil {
-		panic(err)
-	}
-	versionFn, ok := symbol.(func() string)
-	if !ok {
-		panic("deepspeech.Version does not match signature func() string")
-	}
-	version = versionFn()
-	model.SetVersion(version)
-}
-
+// Open opens the model and scorer with the backend named in config. An empty
+// scorerPath opens the model without an external scorer. Zero or negative
+// settings in config are replaced by their defaults; use OpenContext to set
+// them explicitly.
 func Open(modelPath, scorerPath string, config Config) (model.Model, error) {
 	if config.BeamWidth <= 0 {
 		config.BeamWidth = BeamWidth
@@ -80,16 +57,12 @@ func Open(modelPath, scorerPath string, config Config) (model.Model, error) {
 		config.LMBeta = LMBeta
 	}
 
-	m, err := newModel(modelPath, config.BeamWidth)
-	if err != nil {
-		return nil, err
-	}
-	err = m.EnableExternalScorer(scorerPath, config.LMAlpha, config.LMBeta)
-	if err != nil {
-		_ = m.Close()
-		return nil, err
-	}
-	return m, nil
+	return OpenContext(context.Background(), modelPath,
+		WithBackend(config.Backend),
+		WithBeamWidth(config.BeamWidth),
+		WithAlphaBeta(config.LMAlpha, config.LMBeta),
+		WithScorer(scorerPath),
+	)
 }
 
 func DefaultConfig() Config {
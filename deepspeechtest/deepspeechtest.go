@@ -0,0 +1,784 @@
+// Package deepspeechtest provides an in-memory fake of model.Model and
+// model.Stream for testing code that depends on the engine without
+// libdeepspeech or a model file.
+//
+// Results are scripted per utterance: On maps an exact audio buffer to its
+// N-best candidates, Default is used for any other audio and Transcribe can
+// replace the lookup altogether. Latencies and injected errors are configured
+// through Config and FailNext.
+//
+// The fake enforces the lifecycle rules of the real engine. Close fails with
+// model.ErrOpenStreams while streams are open, CloseContext drains or frees
+// them, and a closed model or a finished or freed stream returns os.ErrClosed.
+package deepspeechtest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+const (
+	// SampleRate is the default sample rate of the fake model.
+	SampleRate = 16000
+
+	// Version is reported as the library version by Info.
+	Version = "deepspeechtest"
+
+	// StepDuration is the duration of one timestep, as in libdeepspeech.
+	StepDuration = time.Millisecond * 20
+)
+
+var (
+	_ model.Model  = (*Model)(nil)
+	_ model.Stream = (*Stream)(nil)
+)
+
+// Op identifies a Model or Stream call for error injection.
+type Op int
+
+const (
+	OpCreateStream Op = iota
+	OpEnableExternalScorer
+	OpClose
+	OpSpeechToText
+	OpFree
+	OpFeedAudioContent
+	// OpIntermediateDecode covers both intermediate decode calls.
+	OpIntermediateDecode
+	// OpFinishStream covers all FinishStream variants.
+	OpFinishStream
+)
+
+// Candidate is a scripted transcript. Each rune of Text is one token.
+type Candidate struct {
+	Text       string
+	Confidence float64
+
+	// Timesteps is the timestep of each token. When nil, tokens are placed
+	// Config.StepsPerToken apart starting at timestep 0.
+	Timesteps []int
+}
+
+// Transcriber returns the N-best candidates for the audio fed so far.
+type Transcriber func(audio []int16) []Candidate
+
+// Config configures a fake Model.
+type Config struct {
+	// SampleRate reported by the model. Defaults to SampleRate.
+	SampleRate int
+
+	// BeamWidth reported by the model. Defaults to model.BeamWidth.
+	BeamWidth uint32
+
+	// ModelPath and ModelSize reported by Info.
+	ModelPath string
+	ModelSize int64
+
+	// StepsPerToken spaces generated token timesteps. Defaults to 1.
+	StepsPerToken int
+
+	// HotWordsUnsupported makes the hot-word methods return
+	// model.ErrUnsupported, as with the native engine. Otherwise hot words
+	// behave as in libdeepspeech 0.9.
+	HotWordsUnsupported bool
+
+	// Latencies added to the matching calls.
+	FeedLatency   time.Duration
+	DecodeLatency time.Duration
+	FinishLatency time.Duration
+}
+
+// Model is a fake model.Model.
+type Model struct {
+	config Config
+
+	scripts     map[[sha256.Size]byte][]Candidate
+	fallback    []Candidate
+	transcriber Transcriber
+	failures    map[Op][]error
+
+	beamWidth     uint32
+	scorerPath    string
+	scorerEnabled bool
+	alpha         float32
+	beta          float32
+	hotWords      map[string]float32
+
+	closed  bool
+	counter uint64
+	streams model.StreamTracker
+
+	gate      model.Gate
+	feedQueue model.FeedQueue
+
+	samplesFed int
+	decodeTime time.Duration
+
+	mu sync.Mutex
+}
+
+// New returns a fake model configured by config.
+func New(config Config) *Model {
+	if config.SampleRate <= 0 {
+		config.SampleRate = SampleRate
+	}
+	if config.StepsPerToken <= 0 {
+		config.StepsPerToken = 1
+	}
+	if config.BeamWidth == 0 {
+		config.BeamWidth = model.BeamWidth
+	}
+	return &Model{
+		config:    config,
+		beamWidth: config.BeamWidth,
+		scripts:   make(map[[sha256.Size]byte][]Candidate),
+		failures:  make(map[Op][]error),
+		hotWords:  make(map[string]float32),
+	}
+}
+
+// On scripts the candidates returned for exactly audio.
+func (m *Model) On(audio []int16, candidates ...Candidate) *Model {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scripts[fingerprint(audio)] = candidates
+	return m
+}
+
+// Default scripts the candidates returned for audio without a script.
+func (m *Model) Default(candidates ...Candidate) *Model {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fallback = candidates
+	return m
+}
+
+// Transcribe replaces the scripted lookup with fn.
+func (m *Model) Transcribe(fn Transcriber) *Model {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transcriber = fn
+	return m
+}
+
+// FailNext makes the next call of op return err. Multiple failures for the
+// same op are returned in order.
+func (m *Model) FailNext(op Op, err error) *Model {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures[op] = append(m.failures[op], err)
+	return m
+}
+
+// FailNextFinish makes the next FinishStream fail with err, see
+// modeltest.FinishFailer. The stream is freed, as by the engine.
+func (m *Model) FailNextFinish(err error) {
+	m.FailNext(OpFinishStream, err)
+}
+
+// Scorer returns the scorer path and current weights.
+func (m *Model) Scorer() (path string, alpha, beta float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.scorerPath, m.alpha, m.beta
+}
+
+// HotWords returns a copy of the hot words and their boosts.
+func (m *Model) HotWords() map[string]float32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hotWords := make(map[string]float32, len(m.hotWords))
+	for word, boost := range m.hotWords {
+		hotWords[word] = boost
+	}
+	return hotWords
+}
+
+// OpenStreams returns the number of streams not yet finished or freed.
+func (m *Model) OpenStreams() int {
+	return m.streams.Len()
+}
+
+func (m *Model) EnableExternalScorer(path string, aAlpha, aBeta float32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	if err := m.injected(OpEnableExternalScorer); err != nil {
+		return err
+	}
+	m.scorerPath = path
+	m.scorerEnabled = true
+	m.alpha = aAlpha
+	m.beta = aBeta
+	return nil
+}
+
+func (m *Model) DisableExternalScorer() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	if !m.scorerEnabled {
+		return model.ErrScorerNotEnabled
+	}
+	m.scorerPath = ""
+	m.scorerEnabled = false
+	return nil
+}
+
+func (m *Model) SetScorerAlphaBeta(aAlpha, aBeta float32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	if !m.scorerEnabled {
+		return model.ErrScorerNotEnabled
+	}
+	m.alpha = aAlpha
+	m.beta = aBeta
+	return nil
+}
+
+func (m *Model) ScorerEnabled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.scorerEnabled
+}
+
+func (m *Model) AddHotWord(word string, boost float32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkHotWords(); err != nil {
+		return err
+	}
+	if _, ok := m.hotWords[word]; ok {
+		return model.ErrFailInsertHotWord
+	}
+	m.hotWords[word] = boost
+	return nil
+}
+
+func (m *Model) EraseHotWord(word string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkHotWords(); err != nil {
+		return err
+	}
+	if _, ok := m.hotWords[word]; !ok {
+		return model.ErrFailEraseHotWord
+	}
+	delete(m.hotWords, word)
+	return nil
+}
+
+func (m *Model) ClearHotWords() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkHotWords(); err != nil {
+		return err
+	}
+	m.hotWords = make(map[string]float32)
+	return nil
+}
+
+// checkHotWords returns the error for a hot-word call. Like libdeepspeech,
+// hot words need an enabled scorer but are kept when it is disabled. m.mu
+// must be held.
+func (m *Model) checkHotWords() error {
+	if m.config.HotWordsUnsupported {
+		return model.ErrUnsupported
+	}
+	if m.closed {
+		return os.ErrClosed
+	}
+	if !m.scorerEnabled {
+		return model.ErrScorerNotEnabled
+	}
+	return nil
+}
+
+func (m *Model) SampleRate() int {
+	return m.config.SampleRate
+}
+
+func (m *Model) BeamWidth() uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.beamWidth
+}
+
+func (m *Model) SetBeamWidth(beamWidth uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	m.beamWidth = beamWidth
+	return nil
+}
+
+func (m *Model) Info() model.Info {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return model.Info{
+		SampleRate:    m.config.SampleRate,
+		BeamWidth:     m.beamWidth,
+		ScorerEnabled: m.scorerEnabled,
+		ScorerPath:    m.scorerPath,
+		Alpha:         m.alpha,
+		Beta:          m.beta,
+		Version:       Version,
+		ModelPath:     m.config.ModelPath,
+		ModelSize:     m.config.ModelSize,
+		OpenStreams:   m.streams.Len(),
+		AudioFed:      m.fed(m.samplesFed),
+		DecodeTime:    m.decodeTime,
+	}
+}
+
+// fed converts samples to audio duration.
+func (m *Model) fed(samples int) time.Duration {
+	return time.Duration(samples) * time.Second / time.Duration(m.config.SampleRate)
+}
+
+func (m *Model) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	if err := m.injected(OpClose); err != nil {
+		return err
+	}
+	if m.streams.Len() > 0 {
+		return model.ErrOpenStreams
+	}
+	m.closed = true
+	m.streams.Close()
+	m.gate.Close()
+	return nil
+}
+
+func (m *Model) CloseContext(ctx context.Context) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return os.ErrClosed
+	}
+	m.gate.Close()
+	m.mu.Unlock()
+
+	err := m.streams.Drain(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	m.closed = true
+	m.streams.Close()
+	return err
+}
+
+func (m *Model) Streams() []model.StreamInfo {
+	return m.streams.Streams()
+}
+
+func (m *Model) SetIdleTimeout(timeout time.Duration, report func(model.StreamInfo)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	m.streams.SetIdleTimeout(timeout, report)
+	return nil
+}
+
+func (m *Model) SetAdmission(limits model.Admission) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	m.gate.Set(limits)
+	return nil
+}
+
+func (m *Model) SetFeedQueue(queue model.FeedQueue) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	m.feedQueue = queue
+	return nil
+}
+
+func (m *Model) AdmissionStats() model.AdmissionStats {
+	return m.gate.Stats()
+}
+
+func (m *Model) SetLeakDetector(report func(model.Leak)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	m.streams.SetLeakDetector(report)
+	return nil
+}
+
+func (m *Model) SpeechToText(frame []int16) (string, error) {
+	if err := m.gate.Acquire(context.Background()); err != nil {
+		return "", err
+	}
+	defer m.gate.Release()
+	start := time.Now()
+	sleep(m.config.DecodeLatency)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed || m.streams.Draining() {
+		return "", os.ErrClosed
+	}
+	if err := m.injected(OpSpeechToText); err != nil {
+		return "", err
+	}
+	m.samplesFed += len(frame)
+	m.decodeTime += time.Since(start)
+	candidates := m.candidates(frame)
+	if len(candidates) == 0 {
+		return "", nil
+	}
+	return candidates[0].Text, nil
+}
+
+func (m *Model) CreateStream() (model.Stream, error) {
+	return m.CreateStreamContext(context.Background())
+}
+
+func (m *Model) CreateStreamContext(ctx context.Context) (model.Stream, error) {
+	if err := m.gate.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed || m.streams.Draining() {
+		m.gate.Release()
+		return nil, os.ErrClosed
+	}
+	if err := m.injected(OpCreateStream); err != nil {
+		m.gate.Release()
+		return nil, err
+	}
+	m.counter++
+	now := time.Now()
+	s := &stream{
+		model:        m,
+		id:           m.counter,
+		created:      now,
+		lastActivity: now,
+	}
+	s.queue = model.NewAsyncFeeder(m.feedQueue, s.feed)
+	h := &Stream{s}
+	if err := m.streams.Add(s.id, h, s.tracked()); err != nil {
+		m.gate.Release()
+		return nil, err
+	}
+	return h, nil
+}
+
+func (m *Model) removeStream(s *stream) {
+	if m.streams.Remove(s.id) {
+		m.gate.Release()
+	}
+}
+
+// injected pops the next injected error for op. m.mu must be held.
+func (m *Model) injected(op Op) error {
+	errs := m.failures[op]
+	if len(errs) == 0 {
+		return nil
+	}
+	m.failures[op] = errs[1:]
+	return errs[0]
+}
+
+// candidates returns the scripted candidates for audio. m.mu must be held.
+func (m *Model) candidates(audio []int16) []Candidate {
+	if m.transcriber != nil {
+		return m.transcriber(audio)
+	}
+	if c, ok := m.scripts[fingerprint(audio)]; ok {
+		return c
+	}
+	return m.fallback
+}
+
+func (m *Model) metadata(audio []int16, aNumResults uint32) *model.Metadata {
+	m.mu.Lock()
+	candidates := m.candidates(audio)
+	m.mu.Unlock()
+
+	if uint32(len(candidates)) > aNumResults {
+		candidates = candidates[:aNumResults]
+	}
+	transcripts := make([]model.CandidateTranscript, len(candidates))
+	for i, c := range candidates {
+		transcripts[i] = m.transcript(c)
+	}
+	return &model.Metadata{Transcripts: transcripts}
+}
+
+func (m *Model) transcript(c Candidate) model.CandidateTranscript {
+	text := []rune(c.Text)
+	tokens := make([]model.TokenMetadata, len(text))
+	for i, r := range text {
+		step := i * m.config.StepsPerToken
+		if i < len(c.Timesteps) {
+			step = c.Timesteps[i]
+		}
+		tokens[i] = model.TokenMetadata{
+			Text:      string(r),
+			Timestep:  step,
+			StartTime: float32(time.Duration(step)*StepDuration) / float32(time.Second),
+		}
+	}
+	return model.CandidateTranscript{
+		Tokens:     tokens,
+		Confidence: c.Confidence,
+	}
+}
+
+// Stream is a fake model.Stream. The model only references the embedded
+// stream, so the leak detector's finalizer on Stream runs once the caller drops
+// it.
+type Stream struct {
+	*stream
+}
+
+type stream struct {
+	model        *Model
+	id           uint64
+	created      time.Time
+	lastActivity time.Time
+	decodeTime   time.Duration
+	// queue holds the frames of FeedAsync.
+	queue    *model.AsyncFeeder
+	audio    []int16
+	finished bool
+	mu       sync.Mutex
+}
+
+// Audio returns a copy of the audio fed to the stream.
+func (s *stream) Audio() []int16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int16(nil), s.audio...)
+}
+
+func (s *stream) Free() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(OpFree); err != nil {
+		return err
+	}
+	s.finish()
+	return nil
+}
+
+func (s *stream) IntermediateDecode() (string, error) {
+	mt, err := s.IntermediateDecodeWithMetadata(1)
+	if err != nil {
+		return "", err
+	}
+	return best(mt), nil
+}
+
+func (s *stream) FeedAudioContent(frame []int16) error {
+	_ = s.queue.Flush()
+	return s.feed(frame)
+}
+
+// feed feeds frame without waiting for the FeedAsync queue.
+func (s *stream) feed(frame []int16) error {
+	start := time.Now()
+	sleep(s.model.config.FeedLatency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(OpFeedAudioContent); err != nil {
+		return err
+	}
+	s.audio = append(s.audio, frame...)
+	s.measure(len(frame), start)
+	return nil
+}
+
+func (s *stream) IntermediateDecodeWithMetadata(aNumResults uint32) (*model.Metadata, error) {
+	_ = s.queue.Flush()
+	start := time.Now()
+	sleep(s.model.config.DecodeLatency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(OpIntermediateDecode); err != nil {
+		return nil, err
+	}
+	s.measure(0, start)
+	return s.model.metadata(s.audio, aNumResults), nil
+}
+
+func (s *stream) FinishStream() (string, error) {
+	mt, err := s.FinishStreamWithMetadata(1)
+	if err != nil {
+		return "", err
+	}
+	return best(mt), nil
+}
+
+func (s *stream) FinishStreamWithMetadata(aNumResults uint32) (*model.Metadata, error) {
+	_ = s.queue.Flush()
+	start := time.Now()
+	sleep(s.model.config.FinishLatency)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(OpFinishStream); err != nil {
+		if err != os.ErrClosed {
+			// The engine frees the stream even when finishing fails.
+			s.finish()
+		}
+		return nil, err
+	}
+	s.measure(0, start)
+	mt := s.model.metadata(s.audio, aNumResults)
+	s.finish()
+	return mt, nil
+}
+
+func (s *stream) FinishStreamWithBestHypothesis(aNumResults uint32) (*model.HypothesisCandidate, error) {
+	hyp, err := s.FinishStreamWithHypothesis(aNumResults)
+	if err != nil || len(hyp.Candidates) == 0 {
+		return nil, err
+	}
+	best := hyp.Candidates[0]
+	return &best, nil
+}
+
+func (s *stream) FinishStreamWithHypothesis(aNumResults uint32) (model.Hypothesis, error) {
+	mt, err := s.FinishStreamWithMetadata(aNumResults)
+	if err != nil {
+		return model.Hypothesis{}, err
+	}
+	return model.NewHypothesis(mt), nil
+}
+
+func (s *stream) FeedAsync(frame []int16) error {
+	return s.queue.Feed(frame)
+}
+
+func (s *stream) Flush() error {
+	return s.queue.Flush()
+}
+
+func (s *stream) QueueStats() model.QueueStats {
+	return s.queue.Stats()
+}
+
+// measure records n samples fed and the time since start. s.mu must be held.
+func (s *stream) measure(n int, start time.Time) {
+	now := time.Now()
+	s.lastActivity = now
+	s.decodeTime += now.Sub(start)
+
+	m := s.model
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samplesFed += n
+	m.decodeTime += now.Sub(start)
+}
+
+// info describes the stream. s.mu must be held.
+func (s *stream) info() model.StreamInfo {
+	return model.StreamInfo{
+		ID:           s.id,
+		Created:      s.created,
+		LastActivity: s.lastActivity,
+		AudioFed:     s.model.fed(len(s.audio)),
+		DecodeTime:   s.decodeTime,
+	}
+}
+
+func (s *stream) tracked() model.TrackedStream {
+	return model.TrackedStream{
+		Info: func() model.StreamInfo {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return s.info()
+		},
+		FreeInactive: s.freeInactive,
+	}
+}
+
+// freeInactive frees the stream if it is open and had no activity after
+// cutoff.
+func (s *stream) freeInactive(cutoff time.Time) (model.StreamInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished || s.lastActivity.After(cutoff) {
+		return model.StreamInfo{}, false
+	}
+	info := s.info()
+	s.finish()
+	return info, true
+}
+
+// finish releases the stream. s.mu must be held.
+func (s *stream) finish() {
+	s.finished = true
+	s.queue.Close()
+	s.model.removeStream(s)
+}
+
+// check returns os.ErrClosed for a finished stream, else the next injected
+// error for op. s.mu must be held.
+func (s *stream) check(op Op) error {
+	if s.finished {
+		return os.ErrClosed
+	}
+	s.model.mu.Lock()
+	defer s.model.mu.Unlock()
+	return s.model.injected(op)
+}
+
+func best(mt *model.Metadata) string {
+	if len(mt.Transcripts) == 0 {
+		return ""
+	}
+	text := make([]byte, 0, len(mt.Transcripts[0].Tokens))
+	for _, t := range mt.Transcripts[0].Tokens {
+		text = append(text, t.Text...)
+	}
+	return string(text)
+}
+
+func fingerprint(audio []int16) [sha256.Size]byte {
+	buf := make([]byte, len(audio)*2)
+	for i, v := range audio {
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(v))
+	}
+	return sha256.Sum256(buf)
+}
+
+func sleep(d time.Duration) {
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
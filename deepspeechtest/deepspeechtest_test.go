@@ -0,0 +1,209 @@
+package deepspeechtest
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/model"
+	"github.com/mologix-co/deepspeech-go/model/modeltest"
+)
+
+func TestModel_Scripted(t *testing.T) {
+	hello := []int16{1, 2, 3}
+	m := New(Config{}).
+		On(hello, Candidate{Text: "hello world", Confidence: -1}, Candidate{Text: "yellow world", Confidence: -2}).
+		Default(Candidate{Text: "unknown"})
+
+	s, err := m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.FeedAudioContent(hello[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := s.IntermediateDecode(); text != "unknown" {
+		t.Fatalf("expected default partial, got %q", text)
+	}
+	if err = s.FeedAudioContent(hello[1:]); err != nil {
+		t.Fatal(err)
+	}
+	hyp, err := s.FinishStreamWithHypothesis(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hyp.Candidates) != 2 {
+		t.Fatalf("expected 2 candidates, got %d", len(hyp.Candidates))
+	}
+	best := hyp.Candidates[0]
+	if best.Text != "hello world" || len(best.Words) != 2 || best.Words[1].Value != "world" {
+		t.Fatalf("unexpected best candidate %+v", best)
+	}
+	if text, err := m.SpeechToText(hello); err != nil || text != "hello world" {
+		t.Fatalf("SpeechToText did not use the script: %q, %v", text, err)
+	}
+}
+
+func TestModel_Lifecycle(t *testing.T) {
+	m := New(Config{})
+	s, err := m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Close(); err != model.ErrOpenStreams {
+		t.Fatalf("expected ErrOpenStreams, got %v", err)
+	}
+	if _, err = s.FinishStream(); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Free(); err != os.ErrClosed {
+		t.Fatalf("expected os.ErrClosed on Free after finish, got %v", err)
+	}
+	if err = s.FeedAudioContent([]int16{1}); err != os.ErrClosed {
+		t.Fatalf("expected os.ErrClosed on FeedAudioContent after finish, got %v", err)
+	}
+
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.CreateStream(); err != os.ErrClosed {
+		t.Fatalf("expected os.ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestModel_FailNext(t *testing.T) {
+	m := New(Config{}).FailNext(OpCreateStream, model.ErrFailCreateStream)
+	if _, err := m.CreateStream(); err != model.ErrFailCreateStream {
+		t.Fatalf("expected ErrFailCreateStream, got %v", err)
+	}
+	s, err := m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Free()
+}
+
+func TestModel_Conformance(t *testing.T) {
+	modeltest.Run(t, func(t *testing.T) model.Model {
+		m := New(Config{StepsPerToken: 2}).Default(
+			Candidate{Text: "hello world", Confidence: -1},
+			Candidate{Text: "hello word", Confidence: -2},
+			Candidate{Text: "yellow world", Confidence: -3},
+		)
+		if err := m.EnableExternalScorer("test.scorer", model.LMAlpha, model.LMBeta); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	})
+}
+
+func TestModel_HotWordsUnsupported(t *testing.T) {
+	m := New(Config{HotWordsUnsupported: true})
+	if err := m.AddHotWord("hello", 10); err != model.ErrUnsupported {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestModel_LeakDetector(t *testing.T) {
+	m := New(Config{})
+	leaks := make(chan model.Leak, 1)
+	if err := m.SetLeakDetector(func(leak model.Leak) { leaks <- leak }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateStream(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case leak := <-leaks:
+			if !strings.Contains(string(leak.Stack), "TestModel_LeakDetector") {
+				t.Errorf("leak stack does not show the CreateStream caller:\n%s", leak.Stack)
+			}
+			if err := m.Close(); err != nil {
+				t.Fatalf("Close after the leaked stream was freed: %v", err)
+			}
+			return
+		case <-deadline:
+			t.Fatal("leaked stream was not reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestStream_FeedAsyncPolicy(t *testing.T) {
+	m := New(Config{FeedLatency: 20 * time.Millisecond})
+	if err := m.SetFeedQueue(model.FeedQueue{Size: 1, Policy: model.QueueError}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := false
+	for i := 0; i < 4 && !full; i++ {
+		err = s.FeedAsync([]int16{1, 2, 3})
+		full = err == model.ErrQueueFull
+		if err != nil && !full {
+			t.Fatal(err)
+		}
+	}
+	if !full {
+		t.Fatal("expected ErrQueueFull")
+	}
+	if err = s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := s.QueueStats(); stats.Rejected == 0 || stats.Queued != 0 {
+		t.Fatalf("unexpected %+v", stats)
+	}
+	_ = s.Free()
+
+	if err = m.SetFeedQueue(model.FeedQueue{Size: 1, Policy: model.QueueDropOldest}); err != nil {
+		t.Fatal(err)
+	}
+	s, err = m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if err = s.FeedAsync([]int16{int16(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	stats := s.QueueStats()
+	if stats.Dropped == 0 || stats.Fed+stats.Dropped != 4 {
+		t.Fatalf("unexpected %+v", stats)
+	}
+	// The last frame is never dropped.
+	if audio := s.(*Stream).Audio(); audio[len(audio)-1] != 3 {
+		t.Fatalf("expected the last frame to be fed, got %v", audio)
+	}
+	_ = s.Free()
+
+	m.FailNext(OpFeedAudioContent, model.ErrFailRunSess)
+	if err = m.SetFeedQueue(model.FeedQueue{}); err != nil {
+		t.Fatal(err)
+	}
+	s, err = m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.FeedAsync([]int16{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Flush(); err != model.ErrFailRunSess {
+		t.Fatalf("expected the feed error from Flush, got %v", err)
+	}
+	if err = s.FeedAsync([]int16{1}); err != model.ErrFailRunSess {
+		t.Fatalf("expected the feed error from FeedAsync, got %v", err)
+	}
+	_ = s.Free()
+}
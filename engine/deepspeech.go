@@ -1,4 +1,4 @@
-package main
+package engine
 
 /*
 #include <stdlib.h>
@@ -8,12 +8,12 @@ package main
 */
 import "C"
 import (
+	"context"
 	deepspeech "github.com/mologix-co/deepspeech-go/model"
-	"math"
 	"os"
 	"reflect"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 )
@@ -49,18 +49,43 @@ type metadata struct {
 }
 
 type model struct {
+	// Totals over all streams and SpeechToText calls, updated atomically.
+	samplesFed int64
+	decodeTime int64
+
 	beamWidth  uint32
 	sampleRate int
 	state      *C.ModelState
+	path       string
+	size       int64
+
+	scorerPath    string
+	scorerEnabled bool
+	alpha         float32
+	beta          float32
 
 	counter uint64
-	streams map[uint64]*stream
-	mu      sync.RWMutex
+	streams deepspeech.StreamTracker
+
+	// gate limits open streams and SpeechToText calls.
+	gate deepspeech.Gate
+	// feedQueue configures the FeedAsync queue of new streams.
+	feedQueue deepspeech.FeedQueue
+
+	mu sync.RWMutex
 }
 
 type stream struct {
-	model *model
-	id    uint64
+	// Updated atomically so Streams does not need s.mu.
+	samples      int64
+	lastActivity int64
+	decodeTime   int64
+
+	model   *model
+	id      uint64
+	created time.Time
+	// queue holds the frames of FeedAsync.
+	queue *deepspeech.AsyncFeeder
 	state *C.StreamingState
 	mu    sync.Mutex
 }
@@ -80,17 +105,29 @@ func New(modelPath string, beamWidth uint32) (deepspeech.Model, error) {
 		return nil, deepspeech.ErrorOf(code)
 	}
 
+	var size int64
+	if info, err := os.Stat(modelPath); err == nil {
+		size = info.Size()
+	}
+
 	return &model{
+		path:       modelPath,
+		size:       size,
 		beamWidth:  beamWidth,
 		sampleRate: int(C.DS_GetModelSampleRate(state)),
-		streams:    make(map[uint64]*stream, 1000),
 		state:      state,
 	}, nil
 }
 
+// EnableExternalScorer enables decoding using the scorer at path. Scorer
+// changes take the model's write lock so they never race with CreateStream or
+// SpeechToText; open streams keep the scorer they were created with.
 func (m *model) EnableExternalScorer(path string, aAlpha, aBeta float32) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if m.state == nil {
+		return os.ErrClosed
+	}
 	cstrPath := C.CString(path)
 	defer C.free(unsafe.Pointer(cstrPath))
 
@@ -98,78 +135,191 @@ func (m *model) EnableExternalScorer(path string, aAlpha, aBeta float32) error {
 	if err != nil {
 		return err
 	}
+	m.scorerPath = path
+	m.scorerEnabled = true
+
+	return m.setScorerAlphaBeta(aAlpha, aBeta)
+}
+
+func (m *model) DisableExternalScorer() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == nil {
+		return os.ErrClosed
+	}
+	err := deepspeech.ErrorOf(int(C.DS_DisableExternalScorer(m.state)))
+	if err != nil {
+		return err
+	}
+	m.scorerPath = ""
+	m.scorerEnabled = false
+	return nil
+}
+
+func (m *model) SetScorerAlphaBeta(aAlpha, aBeta float32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == nil {
+		return os.ErrClosed
+	}
+	return m.setScorerAlphaBeta(aAlpha, aBeta)
+}
+
+// setScorerAlphaBeta sets the scorer weights. m.mu must be held.
+func (m *model) setScorerAlphaBeta(aAlpha, aBeta float32) error {
+	err := deepspeech.ErrorOf(int(C.DS_SetScorerAlphaBeta(m.state, C.float(aAlpha), C.float(aBeta))))
+	if err != nil {
+		return err
+	}
+	m.alpha = aAlpha
+	m.beta = aBeta
+	return nil
+}
 
-	err = deepspeech.ErrorOf(int(C.DS_SetScorerAlphaBeta(m.state, C.float(aAlpha), C.float(aBeta))))
-	return err
+func (m *model) ScorerEnabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.scorerEnabled
 }
 
 func (m *model) SampleRate() int {
 	return m.sampleRate
 }
 
+func (m *model) BeamWidth() uint32 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.beamWidth
+}
+
+func (m *model) SetBeamWidth(beamWidth uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == nil {
+		return os.ErrClosed
+	}
+	err := deepspeech.ErrorOf(int(C.DS_SetModelBeamWidth(m.state, C.uint32_t(beamWidth))))
+	if err != nil {
+		return err
+	}
+	m.beamWidth = beamWidth
+	return nil
+}
+
+func (m *model) Info() deepspeech.Info {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return deepspeech.Info{
+		SampleRate:    m.sampleRate,
+		BeamWidth:     m.beamWidth,
+		ScorerEnabled: m.scorerEnabled,
+		ScorerPath:    m.scorerPath,
+		Alpha:         m.alpha,
+		Beta:          m.beta,
+		Version:       Version(),
+		ModelPath:     m.path,
+		ModelSize:     m.size,
+		OpenStreams:   m.streams.Len(),
+		AudioFed:      m.fed(atomic.LoadInt64(&m.samplesFed)),
+		DecodeTime:    time.Duration(atomic.LoadInt64(&m.decodeTime)),
+	}
+}
+
 func (m *model) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if m.state == nil {
 		return os.ErrClosed
 	}
-	if len(m.streams) > 0 {
+	if m.streams.Len() > 0 {
 		return deepspeech.ErrOpenStreams
 	}
+	m.streams.Close()
+	m.gate.Close()
 	C.DS_FreeModel(m.state)
 	m.state = nil
 	return nil
 }
 
-func (m *model) SpeechToText(frame []int16) string {
+func (m *model) SpeechToText(frame []int16) (string, error) {
+	if err := m.gate.Acquire(context.Background()); err != nil {
+		return "", err
+	}
+	defer m.gate.Release()
 	m.mu.RLock()
 	defer m.mu.RUnlock()
+	if m.state == nil || m.streams.Draining() {
+		return "", os.ErrClosed
+	}
+	defer m.measure(len(frame), time.Now())
 	cstr := C.DS_SpeechToText(
 		m.state,
 		(*C.short)(unsafe.Pointer((*reflect.SliceHeader)(unsafe.Pointer(&frame)).Data)),
 		C.uint(len(frame)))
+	if cstr == nil {
+		// DS_SpeechToText only fails when it cannot create its stream.
+		return "", deepspeech.ErrorOf(C.DS_ERR_FAIL_CREATE_STREAM)
+	}
 	// Convert C string to Go string
 	res := C.GoString(cstr)
 	// Free C string
 	C.DS_FreeString(cstr)
-	return res
+	return res, nil
 }
 
 func (m *model) CreateStream() (deepspeech.Stream, error) {
+	return m.CreateStreamContext(context.Background())
+}
+
+func (m *model) CreateStreamContext(ctx context.Context) (deepspeech.Stream, error) {
+	if err := m.gate.Acquire(ctx); err != nil {
+		return nil, err
+	}
 	m.mu.RLock()
-	if m.state == nil {
+	if m.state == nil || m.streams.Draining() {
 		m.mu.RUnlock()
+		m.gate.Release()
 		return nil, os.ErrClosed
 	}
 	var state *C.StreamingState
 	code := int(C.DS_CreateStream(m.state, &state))
 	if code != 0x0000 {
 		m.mu.RUnlock()
+		m.gate.Release()
 		return nil, deepspeech.ErrorOf(code)
 	}
 	m.mu.RUnlock()
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if m.state == nil {
+	if m.state == nil || m.streams.Draining() {
 		C.DS_FreeStream(state)
+		m.gate.Release()
 		return nil, os.ErrClosed
 	}
 	m.counter++
 	stream := &stream{
-		id:    m.counter,
-		state: state,
-		model: m,
+		id:      m.counter,
+		created: time.Now(),
+		state:   state,
+		model:   m,
 	}
-	m.streams[stream.id] = stream
-
-	return stream, nil
+	stream.queue = deepspeech.NewAsyncFeeder(m.feedQueue, stream.feed)
+	stream.touch(0)
+	h := &handle{stream}
+	if err := m.streams.Add(stream.id, h, stream.tracked()); err != nil {
+		C.DS_FreeStream(state)
+		m.gate.Release()
+		return nil, err
+	}
+	return h, nil
 }
 
 func (m *model) removeStream(s *stream) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	delete(m.streams, s.id)
+	s.queue.Close()
+	if m.streams.Remove(s.id) {
+		m.gate.Release()
+	}
 }
 
 func (s *stream) Free() error {
@@ -178,47 +328,92 @@ func (s *stream) Free() error {
 	if s.state == nil {
 		return os.ErrClosed
 	}
+	s.free()
+	return nil
+}
+
+// free releases the stream. s.mu must be held.
+func (s *stream) free() {
 	C.DS_FreeStream(s.state)
 	s.state = nil
 	s.model.removeStream(s)
-	return nil
 }
 
-func (s *stream) IntermediateDecode() string {
+func (s *stream) IntermediateDecode() (string, error) {
+	_ = s.queue.Flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == nil {
+		return "", os.ErrClosed
+	}
+	s.touch(0)
+	defer s.measure(time.Now())
 	cstr := C.DS_IntermediateDecode(s.state)
+	if cstr == nil {
+		return "", deepspeech.ErrorOf(C.DS_ERR_FAIL_RUN_SESS)
+	}
 	defer C.DS_FreeString(cstr)
 	result := C.GoString(cstr)
-	return result
+	return result, nil
+}
+
+func (s *stream) FeedAudioContent(frame []int16) error {
+	_ = s.queue.Flush()
+	return s.feed(frame)
 }
 
-func (s *stream) FeedAudioContent(frame []int16) {
+// feed feeds frame without waiting for the FeedAsync queue.
+func (s *stream) feed(frame []int16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == nil {
+		return os.ErrClosed
+	}
+	s.touch(len(frame))
 	if len(frame) == 0 {
-		return
+		return nil
 	}
+	defer s.measure(time.Now())
 	C.DS_FeedAudioContent(
 		s.state,
 		(*C.short)(unsafe.Pointer((*reflect.SliceHeader)(unsafe.Pointer(&frame)).Data)),
 		C.uint(len(frame)))
+	return nil
 }
 
-func (s *stream) IntermediateDecodeWithMetadata(aNumResults uint32) *deepspeech.Metadata {
+func (s *stream) IntermediateDecodeWithMetadata(aNumResults uint32) (*deepspeech.Metadata, error) {
+	_ = s.queue.Flush()
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return toMetadata(C.DS_IntermediateDecodeWithMetadata(s.state, C.uint32_t(aNumResults)))
+	if s.state == nil {
+		return nil, os.ErrClosed
+	}
+	s.touch(0)
+	defer s.measure(time.Now())
+	mt := toMetadata(C.DS_IntermediateDecodeWithMetadata(s.state, C.uint32_t(aNumResults)))
+	if mt == nil {
+		return nil, deepspeech.ErrorOf(C.DS_ERR_FAIL_RUN_SESS)
+	}
+	return mt, nil
 }
 
-func (s *stream) FinishStream() string {
+func (s *stream) FinishStream() (string, error) {
+	_ = s.queue.Flush()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.state == nil {
-		return ""
+		return "", os.ErrClosed
 	}
+	// The state is freed by DS_FinishStream even when it fails.
+	defer s.measure(time.Now())
 	result := C.DS_FinishStream(s.state)
-	defer C.DS_FreeString(result)
-	res := C.GoString(result)
 	s.state = nil
 	s.model.removeStream(s)
-	return res
+	if result == nil {
+		return "", deepspeech.ErrorOf(C.DS_ERR_FAIL_RUN_SESS)
+	}
+	defer C.DS_FreeString(result)
+	return C.GoString(result), nil
 }
 
 // Signal the end of an audio signal to an ongoing streaming
@@ -230,47 +425,77 @@ func (s *stream) FinishStream() string {
 //         The user is responsible for freeing Metadata by calling {@link DS_FreeMetadata()}. Returns NULL on error.
 //
 // @note This method will free the state pointer (@p aSctx).
-func (s *stream) FinishStreamWithMetadata(aNumResults uint32) *deepspeech.Metadata {
+func (s *stream) FinishStreamWithMetadata(aNumResults uint32) (*deepspeech.Metadata, error) {
+	_ = s.queue.Flush()
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	mt := toMetadata(C.DS_FinishStreamWithMetadata(s.state, C.uint32_t(aNumResults)))
-	s.state = nil
-	s.model.removeStream(s)
-	return mt
+	return s.finishWithMetadata(aNumResults)
 }
 
-func (s *stream) FinishStreamWithBestHypothesis(aNumResults uint32) *deepspeech.HypothesisCandidate {
+func (s *stream) FinishStreamWithBestHypothesis(aNumResults uint32) (*deepspeech.HypothesisCandidate, error) {
+	_ = s.queue.Flush()
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	mt := toMetadata(C.DS_FinishStreamWithMetadata(s.state, C.uint32_t(aNumResults)))
-	s.state = nil
-	s.model.removeStream(s)
+	mt, err := s.finishWithMetadata(aNumResults)
+	if err != nil {
+		return nil, err
+	}
 
-	hyp := NewHypothesis(mt)
+	hyp := deepspeech.NewHypothesis(mt)
 	if len(hyp.Candidates) == 0 {
-		return nil
+		return nil, nil
 	}
 	best := hyp.Candidates[0]
-	return &best
+	return &best, nil
 }
 
-func (s *stream) FinishStreamWithHypothesis(aNumResults uint32) deepspeech.Hypothesis {
+func (s *stream) FinishStreamWithHypothesis(aNumResults uint32) (deepspeech.Hypothesis, error) {
+	_ = s.queue.Flush()
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	mt, err := s.finishWithMetadata(aNumResults)
+	if err != nil {
+		return deepspeech.Hypothesis{}, err
+	}
+	return deepspeech.NewHypothesis(mt), nil
+}
+
+// finishWithMetadata finishes the stream. s.mu must be held.
+func (s *stream) finishWithMetadata(aNumResults uint32) (*deepspeech.Metadata, error) {
+	if s.state == nil {
+		return nil, os.ErrClosed
+	}
+	// The state is freed by DS_FinishStreamWithMetadata even when it fails.
+	defer s.measure(time.Now())
 	mt := toMetadata(C.DS_FinishStreamWithMetadata(s.state, C.uint32_t(aNumResults)))
 	s.state = nil
 	s.model.removeStream(s)
-	return NewHypothesis(mt)
+	if mt == nil {
+		return nil, deepspeech.ErrorOf(C.DS_ERR_FAIL_RUN_SESS)
+	}
+	return mt, nil
 }
 
+// toMetadata copies and frees cMt. It returns nil when cMt is NULL, which the
+// engine returns on error.
 func toMetadata(cMt *C.struct_Metadata) *deepspeech.Metadata {
+	if cMt == nil {
+		return nil
+	}
 	mt := (*metadata)(unsafe.Pointer(cMt))
-	transcripts := ((*[1 << 30]candidateTranscript)(mt.transcripts))[:mt.num_transcripts:mt.num_transcripts]
+	// Silence gives transcripts without tokens, whose arrays may be NULL.
+	var transcripts []candidateTranscript
+	if mt.transcripts != nil && mt.num_transcripts > 0 {
+		transcripts = ((*[1 << 30]candidateTranscript)(mt.transcripts))[:mt.num_transcripts:mt.num_transcripts]
+	}
 	t := make([]deepspeech.CandidateTranscript, len(transcripts))
 	for i, transcript := range transcripts {
-		tokens := ((*[1 << 30]tokenMetadata)(transcript.tokens))[:transcript.num_tokens:transcript.num_tokens]
+		var tokens []tokenMetadata
+		if transcript.tokens != nil && transcript.num_tokens > 0 {
+			tokens = ((*[1 << 30]tokenMetadata)(transcript.tokens))[:transcript.num_tokens:transcript.num_tokens]
+		}
 		ct := deepspeech.CandidateTranscript{
-			Tokens:     make([]deepspeech.TokenMetadata, int(transcript.num_tokens)),
+			Tokens:     make([]deepspeech.TokenMetadata, len(tokens)),
 			Confidence: float64(transcript.confidence),
 		}
 		t[i] = ct
@@ -291,159 +516,3 @@ func toMetadata(cMt *C.struct_Metadata) *deepspeech.Metadata {
 		Transcripts: t,
 	}
 }
-
-func NewHypothesis(m *deepspeech.Metadata) deepspeech.Hypothesis {
-	candidates := make([]deepspeech.HypothesisCandidate, len(m.Transcripts))
-	for i, c := range m.Transcripts {
-		candidates[i] = newHypothesisCandidate(&c)
-	}
-	return deepspeech.Hypothesis{
-		Candidates: candidates,
-	}
-}
-
-func newHypothesisCandidate(m *deepspeech.CandidateTranscript) deepspeech.HypothesisCandidate {
-	isWhitespace := true
-	startStep := 0
-	startTime := time.Duration(0)
-	hyp := deepspeech.HypothesisCandidate{
-		Confidence: m.Confidence,
-		Words:      make([]deepspeech.Word, 0, 8),
-	}
-
-	items := m.Tokens
-	text := strings.Builder{}
-	wordBuf := strings.Builder{}
-
-	lastIndex := len(items) - 1
-	for i, item := range items {
-		if i == 0 {
-			startStep = item.Timestep
-			startTime = time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime)))
-		}
-
-		c := item.Text
-
-		text.WriteString(c)
-
-		// Trim whitespace.
-		c = strings.TrimSpace(c)
-
-		// Is it whitespace?
-		if len(c) == 0 {
-			// End of word?
-			if !isWhitespace {
-				isWhitespace = true
-				// Only if not first character.
-				if i > 0 {
-					endStep := item.Timestep
-					endTime := time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime)))
-					w := deepspeech.Word{
-						Whitespace: false,
-						Value:      wordBuf.String(),
-						StartStep:  startStep,
-						EndStep:    endStep,
-						StartTime:  startTime,
-						EndTime:    endTime,
-					}
-					w.Duration = w.EndTime - w.StartTime
-					hyp.Words = append(hyp.Words, w)
-
-					w.StartStep = w.EndStep + 1
-					w.StartTime = w.EndTime
-
-					wordBuf.Reset()
-				} else if i == lastIndex {
-					//w := Word{
-					//	Whitespace: false,
-					//	Value:      wordBuf.String(),
-					//	StartStep:  startStep,
-					//	EndStep:    item.Timestep(),
-					//	StartTime:  startTime,
-					//	EndTime:    time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime()))),
-					//}
-					//w.Duration = w.EndTime - w.StartTime
-					//hyp.Words = append(hyp.Words, w)
-				}
-
-				startStep = item.Timestep
-				startTime = time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime)))
-			} else if i == lastIndex {
-				//w := Word{
-				//	Whitespace: true,
-				//	Value:      "",
-				//	StartStep:  startStep,
-				//	EndStep:    item.Timestep,
-				//	StartTime:  startTime,
-				//	EndTime:    time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime))),
-				//}
-				//w.Duration = w.EndTime - w.StartTime
-				//hyp.Words = append(hyp.Words, w)
-			}
-		} else {
-			wordBuf.WriteString(c)
-
-			// End of whitespace?
-			if isWhitespace {
-
-				isWhitespace = false
-				// Only if not first character.
-				if i > 0 {
-					//w := Word{
-					//	Whitespace: true,
-					//	Value:      "",
-					//	StartStep:  startStep,
-					//	EndStep:    item.Timestep,
-					//	StartTime:  startTime,
-					//	EndTime:    time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime))),
-					//}
-					//w.Duration = w.EndTime - w.StartTime
-					//hyp.Words = append(hyp.Words, w)
-					//startStep = w.EndStep
-					//startTime = w.EndTime
-
-					startStep = item.Timestep
-					startTime = time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime)))
-				} else if i == lastIndex {
-					w := deepspeech.Word{
-						Whitespace: false,
-						Value:      wordBuf.String(),
-						StartStep:  startStep,
-						EndStep:    item.Timestep,
-						StartTime:  startTime,
-						EndTime:    time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime))),
-					}
-					w.Duration = w.EndTime - w.StartTime
-					hyp.Words = append(hyp.Words, w)
-				}
-
-				startStep = item.Timestep
-				startTime = time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime)))
-			} else if i == lastIndex {
-				w := deepspeech.Word{
-					Whitespace: false,
-					Value:      wordBuf.String(),
-					StartStep:  startStep,
-					EndStep:    item.Timestep,
-					StartTime:  startTime,
-					EndTime:    time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime))),
-				}
-				w.Duration = w.EndTime - w.StartTime
-				hyp.Words = append(hyp.Words, w)
-			}
-		}
-	}
-
-	hyp.Text = text.String()
-	if len(hyp.Words) > 0 {
-		first := hyp.Words[0]
-		last := hyp.Words[len(hyp.Words)-1]
-		hyp.StartStep = first.StartStep
-		hyp.StartTime = first.StartTime
-		hyp.EndStep = last.EndStep
-		hyp.EndTime = last.EndTime
-		hyp.Duration = hyp.EndTime - hyp.StartTime
-	}
-
-	return hyp
-}
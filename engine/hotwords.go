@@ -0,0 +1,102 @@
+package engine
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <stdlib.h>
+#include <dlfcn.h>
+#include "deepspeech.h"
+
+// The hot-word API was added in libdeepspeech 0.9 and is missing from the
+// header the engine is built against, so it is resolved at runtime.
+
+typedef int (*ds_add_hot_word_fn)(ModelState*, const char*, float);
+typedef int (*ds_erase_hot_word_fn)(ModelState*, const char*);
+typedef int (*ds_clear_all_hot_words_fn)(ModelState*);
+
+#define DS_HOT_WORD_UNSUPPORTED -1
+
+static int ds_add_hot_word(ModelState* aCtx, const char* word, float boost) {
+	ds_add_hot_word_fn fn = (ds_add_hot_word_fn)dlsym(RTLD_DEFAULT, "DS_AddHotWord");
+	if (fn == NULL) {
+		return DS_HOT_WORD_UNSUPPORTED;
+	}
+	return fn(aCtx, word, boost);
+}
+
+static int ds_erase_hot_word(ModelState* aCtx, const char* word) {
+	ds_erase_hot_word_fn fn = (ds_erase_hot_word_fn)dlsym(RTLD_DEFAULT, "DS_EraseHotWord");
+	if (fn == NULL) {
+		return DS_HOT_WORD_UNSUPPORTED;
+	}
+	return fn(aCtx, word);
+}
+
+static int ds_clear_all_hot_words(ModelState* aCtx) {
+	ds_clear_all_hot_words_fn fn = (ds_clear_all_hot_words_fn)dlsym(RTLD_DEFAULT, "DS_ClearAllHotWords");
+	if (fn == NULL) {
+		return DS_HOT_WORD_UNSUPPORTED;
+	}
+	return fn(aCtx);
+}
+*/
+import "C"
+import (
+	"os"
+	"unsafe"
+
+	deepspeech "github.com/mologix-co/deepspeech-go/model"
+)
+
+// The hot-word methods return ErrUnsupported unless the loaded libdeepspeech is
+// 0.9 or later. libdeepspeech keeps the hot words across scorer changes and
+// reports the errors of model.Model itself.
+
+func hotWordError(code C.int) error {
+	if code == C.DS_HOT_WORD_UNSUPPORTED {
+		return deepspeech.ErrUnsupported
+	}
+	return deepspeech.ErrorOf(int(code))
+}
+
+func (m *model) AddHotWord(word string, boost float32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkHotWords(); err != nil {
+		return err
+	}
+	cstrWord := C.CString(word)
+	defer C.free(unsafe.Pointer(cstrWord))
+	return hotWordError(C.ds_add_hot_word(m.state, cstrWord, C.float(boost)))
+}
+
+func (m *model) EraseHotWord(word string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkHotWords(); err != nil {
+		return err
+	}
+	cstrWord := C.CString(word)
+	defer C.free(unsafe.Pointer(cstrWord))
+	return hotWordError(C.ds_erase_hot_word(m.state, cstrWord))
+}
+
+func (m *model) ClearHotWords() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkHotWords(); err != nil {
+		return err
+	}
+	return hotWordError(C.ds_clear_all_hot_words(m.state))
+}
+
+// checkHotWords returns os.ErrClosed for a closed model and ErrUnsupported
+// before libdeepspeech 0.9. m.mu must be held.
+func (m *model) checkHotWords() error {
+	if m.state == nil {
+		return os.ErrClosed
+	}
+	if !deepspeech.HotWordsSupported(Version()) {
+		return deepspeech.ErrUnsupported
+	}
+	return nil
+}
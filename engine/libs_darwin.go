@@ -1,8 +1,8 @@
 // +build darwin
 
-package main
+package engine
 
 /*
-#cgo darwin LDFLAGS: -Wl,-rpath,./ -L./mac -ldeepspeech
+#cgo darwin LDFLAGS: -Wl,-rpath,@loader_path -L${SRCDIR}/mac -ldeepspeech
 */
 import "C"
@@ -1,8 +1,8 @@
 // +build linux
 
-package main
+package engine
 
 /*
-#cgo linux LDFLAGS: -Wl,-rpath,./ -L./linux -ldeepspeech
+#cgo linux LDFLAGS: -Wl,-rpath,$ORIGIN -L${SRCDIR}/linux -ldeepspeech
 */
 import "C"
@@ -0,0 +1,24 @@
+// Command plugin builds the engine as a Go plugin loaded by the deepspeech
+// package at runtime:
+//
+//	go build -buildmode=plugin -o ../deepspeech_plugin.so
+package main
+
+import (
+	"github.com/mologix-co/deepspeech-go/engine"
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+func New(modelPath string, beamWidth uint32) (model.Model, error) {
+	return engine.New(modelPath, beamWidth)
+}
+
+func Version() string {
+	return engine.Version()
+}
+
+func BuildVersion() string {
+	return engine.BuildVersion()
+}
+
+func main() {}
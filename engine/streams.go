@@ -0,0 +1,161 @@
+package engine
+
+/*
+#include "deepspeech.h"
+*/
+import "C"
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	deepspeech "github.com/mologix-co/deepspeech-go/model"
+)
+
+// touch records activity and n samples fed.
+func (s *stream) touch(n int) {
+	if n > 0 {
+		atomic.AddInt64(&s.samples, int64(n))
+		atomic.AddInt64(&s.model.samplesFed, int64(n))
+	}
+	atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+}
+
+// measure adds the decode time since start.
+func (s *stream) measure(start time.Time) {
+	d := int64(time.Since(start))
+	atomic.AddInt64(&s.decodeTime, d)
+	atomic.AddInt64(&s.model.decodeTime, d)
+}
+
+// measure adds n samples decoded by SpeechToText since start.
+func (m *model) measure(n int, start time.Time) {
+	atomic.AddInt64(&m.samplesFed, int64(n))
+	atomic.AddInt64(&m.decodeTime, int64(time.Since(start)))
+}
+
+// fed converts samples to audio duration.
+func (m *model) fed(samples int64) time.Duration {
+	return time.Duration(samples) * time.Second / time.Duration(m.sampleRate)
+}
+
+func (s *stream) info() deepspeech.StreamInfo {
+	return deepspeech.StreamInfo{
+		ID:           s.id,
+		Created:      s.created,
+		LastActivity: time.Unix(0, atomic.LoadInt64(&s.lastActivity)),
+		AudioFed:     s.model.fed(atomic.LoadInt64(&s.samples)),
+		DecodeTime:   time.Duration(atomic.LoadInt64(&s.decodeTime)),
+	}
+}
+
+func (m *model) Streams() []deepspeech.StreamInfo {
+	return m.streams.Streams()
+}
+
+// CloseContext stops accepting new streams, waits for the open ones to finish
+// and closes the model. When ctx is done first the remaining streams are freed,
+// the model is closed and ctx.Err() is returned.
+func (m *model) CloseContext(ctx context.Context) error {
+	m.mu.Lock()
+	if m.state == nil {
+		m.mu.Unlock()
+		return os.ErrClosed
+	}
+	m.gate.Close()
+	m.mu.Unlock()
+
+	err := m.streams.Drain(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == nil {
+		// Closed by a concurrent call.
+		return os.ErrClosed
+	}
+	m.streams.Close()
+	C.DS_FreeModel(m.state)
+	m.state = nil
+	return err
+}
+
+func (m *model) SetIdleTimeout(timeout time.Duration, report func(deepspeech.StreamInfo)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == nil {
+		return os.ErrClosed
+	}
+	m.streams.SetIdleTimeout(timeout, report)
+	return nil
+}
+
+func (s *stream) tracked() deepspeech.TrackedStream {
+	return deepspeech.TrackedStream{Info: s.info, FreeInactive: s.freeInactive}
+}
+
+// freeInactive frees the stream if it is open and had no activity after
+// cutoff.
+func (s *stream) freeInactive(cutoff time.Time) (deepspeech.StreamInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == nil || atomic.LoadInt64(&s.lastActivity) > cutoff.UnixNano() {
+		return deepspeech.StreamInfo{}, false
+	}
+	info := s.info()
+	s.free()
+	return info, true
+}
+
+func (m *model) SetAdmission(limits deepspeech.Admission) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.state == nil {
+		return os.ErrClosed
+	}
+	m.gate.Set(limits)
+	return nil
+}
+
+func (m *model) AdmissionStats() deepspeech.AdmissionStats {
+	return m.gate.Stats()
+}
+
+func (m *model) SetLeakDetector(report func(deepspeech.Leak)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == nil {
+		return os.ErrClosed
+	}
+	m.streams.SetLeakDetector(report)
+	return nil
+}
+
+// handle is the stream returned by CreateStream. The model only references the
+// stream, so the leak detector's finalizer on the handle runs once the caller
+// drops it.
+type handle struct {
+	*stream
+}
+
+func (m *model) SetFeedQueue(queue deepspeech.FeedQueue) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == nil {
+		return os.ErrClosed
+	}
+	m.feedQueue = queue
+	return nil
+}
+
+func (s *stream) FeedAsync(frame []int16) error {
+	return s.queue.Feed(frame)
+}
+
+func (s *stream) Flush() error {
+	return s.queue.Flush()
+}
+
+func (s *stream) QueueStats() deepspeech.QueueStats {
+	return s.queue.Stats()
+}
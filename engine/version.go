@@ -0,0 +1,10 @@
+package engine
+
+// buildVersion is the libdeepspeech version deepspeech.h was taken from.
+// Keep it in sync with the header when upgrading the engine.
+const buildVersion = "0.7.4"
+
+// BuildVersion returns the libdeepspeech version the engine was built against.
+func BuildVersion() string {
+	return buildVersion
+}
@@ -33,6 +33,18 @@ func main1() {
 		panic(err)
 	}
 
+	// Limit concurrent streams to what the CPUs decode in real time; the
+	// remaining workers wait for a slot.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	controller := ds.NewCapacityController(m, ds.CapacityConfig{
+		MaxQueue: goroutines,
+		Publish: func(c ds.Capacity) {
+			fmt.Printf("RTF: %.3f Load: %.2f Streams: %d/%d\n", c.RealTimeFactor, c.Load, c.Active, c.Streams)
+		},
+	})
+	go controller.Run(ctx)
+
 	var wg sync.WaitGroup
 	for i := 0; i < goroutines; i++ {
 		start(i, m, iterations, sound, &wg)
@@ -70,7 +82,7 @@ func main() {
 
 		fmt.Printf("Wav Sample Rate: %d\n", fileReader.SampleRate())
 
-		var stream ds.Stream
+		var recognizer *ds.Recognizer
 
 		reader := audio.NewReplayReader(fileReader, time.Millisecond*80)
 
@@ -84,14 +96,8 @@ func main() {
 		started := time.Now()
 
 		feedDur := time.Duration(0)
-		intermediateDur := time.Duration(0)
 		finishDur := time.Duration(0)
 
-		lastIntermediate := ""
-
-		_ = intermediateDur
-		_ = lastIntermediate
-
 		var begin time.Time
 		var end time.Time
 
@@ -99,7 +105,6 @@ func main() {
 		frameCount := 0
 		feedCount := 0
 		finishCount := 0
-		intermediateCount := 0
 		for {
 			buf, err := reader.ReadFrame()
 			if err != nil && err != io.EOF {
@@ -120,8 +125,24 @@ func main() {
 
 			switch vadState {
 			case vad.Active:
-				if stream == nil {
-					stream, err = m.CreateStream()
+				if recognizer == nil {
+					stream, err := m.CreateStream()
+					if err != nil {
+						panic(err)
+					}
+					// Partials are decoded every 200ms of audio; unchanged ones
+					// are skipped.
+					recognizer = ds.NewRecognizer(stream, ds.RecognizerConfig{
+						SampleRate: m.SampleRate(),
+						Candidates: 5,
+						OnEvent: func(e ds.Event) {
+							// Committed words no longer change; the bracketed
+							// tail may.
+							if e.Type == ds.Partial && len(e.Text) > 0 {
+								fmt.Printf("\t\t\t%s [%s]\n", e.Stable.CommittedText(), e.Stable.VolatileText())
+							}
+						},
+					})
 				}
 				if !speaking {
 					silentFrames := utteranceCount
@@ -141,23 +162,11 @@ func main() {
 
 				feedCount++
 				begin = time.Now()
-				stream.FeedAudioContent(buf)
+				if err := recognizer.Feed(buf); err != nil {
+					panic(err)
+				}
 				end = time.Now()
 				feedDur += end.Sub(begin)
-
-				if utteranceCount%10 == 0 {
-					begin = time.Now()
-
-					intermediateCount++
-					//intermediate2 := stream.IntermediateDecodeWithMetadata(10)
-					intermediate := stream.IntermediateDecode()
-					end = time.Now()
-					intermediateDur += end.Sub(begin)
-					if len(intermediate) > 0 && lastIntermediate != intermediate {
-						fmt.Printf("\t\t\t%s\n", intermediate)
-					}
-					lastIntermediate = intermediate
-				}
 				utteranceCount++
 
 			case vad.NonActive:
@@ -170,13 +179,18 @@ func main() {
 					//fmt.Printf("\t\tFrames: %d\n", speechFrames)
 					//fmt.Printf("\t\tDuration: %v\n", time.Duration(speechFrames)*audio.Ptime10ms)
 					speaking = false
-					if stream != nil {
+					if recognizer != nil {
 						finishCount++
 						begin = time.Now()
-						hyp := stream.FinishStreamWithBestHypothesis(5)
-						stream = nil
-						fmt.Printf("\t\tText: %v\n", hyp.Text)
-						fmt.Printf("\t\tDur:  %v\n", hyp.Duration)
+						final, err := recognizer.Finish()
+						if err != nil {
+							panic(err)
+						}
+						recognizer = nil
+						fmt.Printf("\t\tText: %v\n", final.Text)
+						if final.Hypothesis != nil {
+							fmt.Printf("\t\tDur:  %v\n", final.Hypothesis.Duration)
+						}
 						end = time.Now()
 						finishDur += end.Sub(begin)
 					}
@@ -206,8 +220,6 @@ func main() {
 		//fmt.Printf("\t\tFinish Duration: %v\n", finishDur)
 		//fmt.Printf("\t\tFinish Count: %v\n", finishCount)
 		fmt.Printf("\t\tFinish Duration: 		%v\n", finishDur / time.Duration(finishCount))
-		fmt.Printf("\t\tIntermediate Duration: 		%v\n", intermediateDur / time.Duration(intermediateCount))
-		//fmt.Printf("\t\tIntermediate Duration: %v\n", intermediateDur)
 
 		_ = reader.Close()
 		_ = fileReader.Close()
@@ -311,57 +323,10 @@ func (f *frameReader) Replay(limit int, fn func(frame []int16)) int {
 	return n
 }
 
-type msg struct {
-	id  int
-	cpu float64
-}
-
-type hypervisor struct {
-	cores []*core
-	ch    chan msg
-
-	ctx    context.Context
-	cancel context.CancelFunc
-	wg     sync.WaitGroup
-
-	targetCoreLoad float64 // CPU percentage
-	avgCoreLoad    float64
-	minCoreLoad    float64
-	maxCoreLoad    float64
-}
-
-func startHypervisor() *hypervisor {
-	ctx, cancel := context.WithCancel(context.Background())
-	h := &hypervisor{
-		cores:  make([]*core, 0, runtime.NumCPU()*4),
-		ctx:    ctx,
-		cancel: cancel,
-	}
-	h.wg.Add(1)
-	go h.run()
-	return h
-}
-
-func (h *hypervisor) run() {
-	defer h.wg.Done()
-	for {
-		select {
-		case <-h.ctx.Done():
-			return
-		case m := <-h.ch:
-			_ = m
-
-		case <-time.After(time.Millisecond * 100):
-
-		}
-	}
-}
-
 type core struct {
-	kernel *hypervisor
-	id     int
-	model  deepspeech.Model
-	sound  *soundData
+	id    int
+	model deepspeech.Model
+	sound *soundData
 
 	ptime int
 
@@ -482,7 +447,10 @@ func (r *core) run() {
 					begin = time.Now()
 
 					//intermediate2 := stream.IntermediateDecodeWithMetadata(10)
-					intermediate := stream.IntermediateDecode()
+					intermediate, err := stream.IntermediateDecode()
+					if err != nil {
+						panic(err)
+					}
 					end = time.Now()
 					intermediateDur += end.Sub(begin)
 					if len(intermediate) > 0 && lastIntermediate != intermediate {
@@ -504,7 +472,10 @@ func (r *core) run() {
 					speaking = false
 					if stream != nil {
 						begin = time.Now()
-						hyp := stream.FinishStreamWithBestHypothesis(1)
+						hyp, err := stream.FinishStreamWithBestHypothesis(1)
+						if err != nil {
+							panic(err)
+						}
 						stream = nil
 						//fmt.Printf("\t\tText: %v\n", hyp.Text)
 						//fmt.Printf("\t\tDur:  %v\n", hyp.Duration)
@@ -533,11 +504,6 @@ func (r *core) run() {
 		fmt.Printf("\tCPU Percentage: %v\n", cpu)
 		//fmt.Printf("\tFrames: %d\n", r.sound.duration)
 
-		//r.kernel.ch <- msg{
-		//	id:  r.id,
-		//	cpu: cpu,
-		//}
-
 		//fmt.Printf("\tCPU: %v\n", time.Now().Sub(started))
 		//fmt.Printf("\t\tFeed Duration: %v\n", feedDur)
 		//fmt.Printf("\t\tFinish Duration: %v\n", finishDur)
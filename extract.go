@@ -1,26 +1,173 @@
+// +build !deepspeech_system,!deepspeech_cgo
+
 package deepspeech
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+)
+
+const (
+	pluginFileName = "deepspeech_plugin.so"
+	libFileName    = "libdeepspeech.so"
+	lockFileName   = ".lock"
 )
 
-func extract(plugin, ds string) {
-	extractTo(plugin, "deepspeech_plugin.so")
-	extractTo(ds, "libdeepspeech.so")
+// ErrChecksum is returned when an engine library does not match the SHA-256
+// recorded when it was embedded.
+var ErrChecksum = errors.New("deepspeech: checksum mismatch")
+
+// extract writes the embedded plugin and library into a subdirectory of dir
+// named after the hash of their contents and returns the absolute plugin path.
+// An empty ds skips the library, e.g. when LoadOptions.LibPath is given.
+//
+// Files are written to a temporary file, synced and renamed into place while
+// holding an advisory lock on the directory, so concurrent processes never see
+// a partially written library and never truncate one that is already mapped.
+// An existing extraction whose SHA-256 matches is reused.
+func extract(dir, plugin, ds string) (string, error) {
+	pluginFile, err := openEmbeddedFile(plugin)
+	if err != nil {
+		return "", &LoadError{Op: "extract", Path: plugin, Err: err}
+	}
+	libs := []embeddedLib{{plugin, pluginFile.data, pluginFile.sha256}}
+	if ds != "" {
+		libFile, err := openEmbeddedFile(ds)
+		if err != nil {
+			return "", &LoadError{Op: "extract", Path: ds, Err: err}
+		}
+		libs = append(libs, embeddedLib{ds, libFile.data, libFile.sha256})
+	}
+	return extractFiles(dir, libs[0], libs[1:]...)
+}
+
+// embeddedLib is an embedded engine library and its recorded SHA-256.
+type embeddedLib struct {
+	name   string
+	data   []byte
+	sha256 string
 }
 
-func extractTo(from, to string) {
-	file, err := openEmbeddedFile(from)
+// extractFiles extracts plugin and at most one library, see extract.
+func extractFiles(dir string, plugin embeddedLib, libs ...embeddedLib) (string, error) {
+	files := append([]embeddedLib{plugin}, libs...)
+	sums := make([]string, len(files))
+	for i, f := range files {
+		if !checksumMatches(f.data, f.sha256) {
+			return "", &LoadError{Op: "extract", Path: f.name, Err: ErrChecksum}
+		}
+		sums[i] = f.sha256
+	}
+
+	dir, err := filepath.Abs(filepath.Join(dir, contentHash(sums...)))
 	if err != nil {
-		panic(err)
+		return "", &LoadError{Op: "extract", Path: dir, Err: err}
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", &LoadError{Op: "extract", Path: dir, Err: err}
+	}
+
+	lockPath := filepath.Join(dir, lockFileName)
+	unlock, err := lockFile(lockPath)
+	if err != nil {
+		return "", &LoadError{Op: "extract", Path: lockPath, Err: err}
+	}
+	defer unlock()
+
+	pluginPath := filepath.Join(dir, pluginFileName)
+	if err = extractTo(plugin.data, plugin.sha256, pluginPath); err != nil {
+		return "", err
+	}
+	for _, lib := range libs {
+		if err = extractTo(lib.data, lib.sha256, filepath.Join(dir, libFileName)); err != nil {
+			return "", err
+		}
+	}
+	if err = syncDir(dir); err != nil {
+		return "", &LoadError{Op: "extract", Path: dir, Err: err}
+	}
+	return pluginPath, nil
+}
+
+func extractTo(data []byte, sum string, to string) error {
+	if ok, _ := fileChecksumMatches(to, sum); ok {
+		// Already extracted.
+		return nil
 	}
 
-	pluginFile, err := os.OpenFile(to, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0755)
+	tmp, err := ioutil.TempFile(filepath.Dir(to), "."+filepath.Base(to)+".*")
 	if err != nil {
-		panic(err)
+		return &LoadError{Op: "extract", Path: to, Err: err}
+	}
+	tmpPath := tmp.Name()
+	ok := false
+	defer func() {
+		if !ok {
+			_ = tmp.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return &LoadError{Op: "extract", Path: tmpPath, Err: err}
+	}
+	if err = tmp.Chmod(0755); err != nil {
+		return &LoadError{Op: "extract", Path: tmpPath, Err: err}
+	}
+	if err = tmp.Sync(); err != nil {
+		return &LoadError{Op: "extract", Path: tmpPath, Err: err}
+	}
+	if err = tmp.Close(); err != nil {
+		return &LoadError{Op: "extract", Path: tmpPath, Err: err}
+	}
+	if match, err := fileChecksumMatches(tmpPath, sum); err != nil {
+		return &LoadError{Op: "extract", Path: tmpPath, Err: err}
+	} else if !match {
+		return &LoadError{Op: "extract", Path: tmpPath, Err: ErrChecksum}
+	}
+	if err = os.Rename(tmpPath, to); err != nil {
+		return &LoadError{Op: "extract", Path: to, Err: err}
+	}
+	ok = true
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func checksumMatches(data []byte, sum string) bool {
+	actual := sha256.Sum256(data)
+	return hex.EncodeToString(actual[:]) == sum
+}
+
+func fileChecksumMatches(path, sum string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return false, err
+	}
+	return hex.EncodeToString(h.Sum(nil)) == sum, nil
+}
+
+func contentHash(sums ...string) string {
+	h := sha256.New()
+	for _, sum := range sums {
+		h.Write([]byte(sum))
 	}
-	defer pluginFile.Close()
-	reader := bytes.NewReader(file.data)
-	reader.WriteTo(pluginFile)
+	return hex.EncodeToString(h.Sum(nil))[:16]
 }
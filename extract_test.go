@@ -0,0 +1,154 @@
+// +build !deepspeech_system,!deepspeech_cgo
+
+package deepspeech
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testLib(name, data string) embeddedLib {
+	sum := sha256.Sum256([]byte(data))
+	return embeddedLib{name: name, data: []byte(data), sha256: hex.EncodeToString(sum[:])}
+}
+
+// dirEntries returns the names of the files in dir.
+func dirEntries(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	return names
+}
+
+func TestExtractFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deepspeech")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plugin, lib := testLib("plugin", "plugin data"), testLib("lib", "lib data")
+	pluginPath, err := extractFiles(dir, plugin, lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(pluginPath)
+	if err != nil || string(data) != "plugin data" {
+		t.Fatalf("plugin = %q, %v", data, err)
+	}
+	data, err = ioutil.ReadFile(filepath.Join(filepath.Dir(pluginPath), libFileName))
+	if err != nil || string(data) != "lib data" {
+		t.Fatalf("lib = %q, %v", data, err)
+	}
+
+	// A matching extraction is reused without being rewritten.
+	before, err := os.Stat(pluginPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := extractFiles(dir, plugin, lib)
+	if err != nil || again != pluginPath {
+		t.Fatalf("extractFiles again = %q, %v; want %q", again, err, pluginPath)
+	}
+	after, err := os.Stat(pluginPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("matching plugin was rewritten")
+	}
+
+	// A changed library goes to another directory.
+	other, err := extractFiles(dir, plugin, testLib("lib", "other lib data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(other) == filepath.Dir(pluginPath) {
+		t.Error("changed library extracted into the same directory")
+	}
+
+	// Without a library, e.g. with LoadOptions.LibPath, only the plugin is
+	// extracted.
+	alone, err := extractFiles(dir, plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(filepath.Dir(alone), libFileName)); !os.IsNotExist(err) {
+		t.Errorf("library extracted without being asked for: %v", err)
+	}
+	if data, err := ioutil.ReadFile(alone); err != nil || string(data) != "plugin data" {
+		t.Fatalf("plugin = %q, %v", data, err)
+	}
+}
+
+func TestExtractFiles_Checksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deepspeech")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lib := testLib("lib", "lib data")
+	lib.data = []byte("corrupted")
+	_, err = extractFiles(dir, testLib("plugin", "plugin data"), lib)
+	var loadErr *LoadError
+	if !errors.As(err, &loadErr) || loadErr.Path != "lib" || !errors.Is(err, ErrChecksum) {
+		t.Fatalf("err = %v, want a checksum LoadError for lib", err)
+	}
+	if names := dirEntries(t, dir); len(names) != 0 {
+		t.Errorf("files left after checksum mismatch: %v", names)
+	}
+}
+
+func TestExtractTo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deepspeech")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	to := filepath.Join(dir, libFileName)
+	lib := testLib("lib", "lib data")
+
+	// A wrong checksum fails without leaving the file or a temporary file.
+	if err := extractTo(lib.data, testLib("", "other").sha256, to); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("extractTo = %v, want ErrChecksum", err)
+	}
+	if names := dirEntries(t, dir); len(names) != 0 {
+		t.Fatalf("files left after failed extraction: %v", names)
+	}
+
+	// A stale file is replaced.
+	if err := ioutil.WriteFile(to, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := extractTo(lib.data, lib.sha256, to); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(to); string(data) != "lib data" {
+		t.Fatalf("extracted %q", data)
+	}
+
+	// A matching file is reused.
+	if err := os.Chmod(to, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := extractTo(lib.data, lib.sha256, to); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(to); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("matching file was rewritten: %v, %v", info.Mode(), err)
+	}
+	if names := dirEntries(t, dir); len(names) != 1 || names[0] != libFileName {
+		t.Errorf("files = %v, want only %s", names, libFileName)
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -108,6 +110,7 @@ type _embeddedFile struct {
 	Local      string
 	ModTime    int64
 	Compressed string
+	Sha256     string
 
 	fileinfo os.FileInfo
 }
@@ -209,6 +212,8 @@ func Run(conf *Config, out io.Writer) error {
 					fileinfo: fi,
 					ModTime:  fi.ModTime().Unix(),
 				}
+				sum := sha256.Sum256(b)
+				escFile.Sha256 = hex.EncodeToString(sum[:])
 				if modTime != nil {
 					escFile.ModTime = *modTime
 				}
@@ -311,6 +316,7 @@ type _embeddedFile struct {
 	compressed string
 	size       int64
 	modtime    int64
+	sha256     string
 	local      string
 	isDir      bool
 	once sync.Once
@@ -349,6 +355,7 @@ var _embeddedFiles = map[string]*_embeddedFile{
 		local:   "{{ .Local }}",
 		size:    {{ .Data | len  }},
 		modtime: {{ .ModTime }},
+		sha256:  "{{ .Sha256 }}",
 		compressed: ` + "`" + `{{ .Compressed }}` + "`" + `,
 	},
 {{ end -}}
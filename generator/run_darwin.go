@@ -1,10 +1,11 @@
 // +build darwin
+
 package main
 
 func run() {
 	generate([]string{
 		"../engine/mac/libdeepspeech.so", "../engine/deepspeech_plugin.dylib"},
 		"../libs_darwin.go",
-		"// +build darwin",
+		"// +build darwin,!deepspeech_system,!deepspeech_cgo\n",
 	)
 }
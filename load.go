@@ -0,0 +1,190 @@
+package deepspeech
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+const (
+	// EnvCacheDir overrides the directory the engine libraries are extracted to.
+	EnvCacheDir = "DEEPSPEECH_CACHE_DIR"
+
+	// EnvPluginPath overrides the path of the engine plugin. When set the
+	// embedded engine is not extracted.
+	EnvPluginPath = "DEEPSPEECH_PLUGIN_PATH"
+
+	// EnvLibPath overrides the path of libdeepspeech. The library is loaded
+	// before the plugin so it is used instead of the embedded copy.
+	EnvLibPath = "DEEPSPEECH_LIB_PATH"
+
+	notLoaded = "not loaded"
+)
+
+var (
+	// ErrNotEmbedded is returned when the engine libraries are not embedded in
+	// this build and no plugin path was given.
+	ErrNotEmbedded = errors.New("deepspeech: engine libraries are not embedded in this build")
+
+	// ErrSignature is returned when a plugin symbol does not have the expected type.
+	ErrSignature = errors.New("deepspeech: plugin symbol signature mismatch")
+
+	loadMu sync.Mutex
+	loaded bool
+)
+
+// LoadOptions controls how the engine libraries are extracted and loaded.
+type LoadOptions struct {
+	// Dir is the cache directory the embedded engine libraries are extracted
+	// to. Each build is extracted into its own content-hash subdirectory.
+	// Defaults to DefaultCacheDir().
+	Dir string
+
+	// PluginPath is the path of a prebuilt engine plugin. When set nothing is
+	// extracted. Defaults to $DEEPSPEECH_PLUGIN_PATH.
+	PluginPath string
+
+	// LibPath is the path of a system-installed libdeepspeech to use instead
+	// of the embedded one, which is then not extracted. Defaults to
+	// $DEEPSPEECH_LIB_PATH.
+	LibPath string
+}
+
+// engineFuncs are the entry points of the engine package, either looked up in
+// the plugin or linked in directly.
+type engineFuncs struct {
+	newModel     func(string, uint32) (model.Model, error)
+	version      func() string
+	buildVersion func() string
+}
+
+// LoadError describes a failure while loading the engine.
+type LoadError struct {
+	// Op is the step that failed: "extract", "open", "lookup" or "version".
+	Op string
+	// Path is the file or symbol involved.
+	Path string
+	Err  error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("deepspeech: %s %s: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// VersionMismatchError is returned when the loaded libdeepspeech is not the
+// version the engine plugin was built against.
+type VersionMismatchError struct {
+	// Built is the version the plugin was built against.
+	Built string
+	// Loaded is the version reported by DS_Version().
+	Loaded string
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("libdeepspeech version %s does not match version %s the engine was built against", e.Loaded, e.Built)
+}
+
+// DefaultCacheDir returns the directory the engine libraries are extracted to
+// when LoadOptions.Dir is empty. It is $DEEPSPEECH_CACHE_DIR if set, otherwise
+// "deepspeech-go" inside the user's cache directory.
+func DefaultCacheDir() (string, error) {
+	if dir := os.Getenv(EnvCacheDir); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "deepspeech-go"), nil
+}
+
+// Init loads the engine with the default LoadOptions.
+// It is called by Open, so calling it directly is only needed to surface
+// load errors early.
+func Init() error {
+	return Load(LoadOptions{})
+}
+
+// Load extracts and opens the engine plugin. When built with the deepspeech_cgo
+// tag the engine is linked in directly and only the version check is done.
+//
+// It is safe to call concurrently and more than once; once loading succeeded
+// further calls are no-ops. A failed load leaves the engine unloaded so it may
+// be retried.
+func Load(opts LoadOptions) error {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	if loaded {
+		return nil
+	}
+
+	if opts.PluginPath == "" {
+		opts.PluginPath = os.Getenv(EnvPluginPath)
+	}
+	if opts.LibPath == "" {
+		opts.LibPath = os.Getenv(EnvLibPath)
+	}
+
+	funcs, source, err := openEngine(opts)
+	if err != nil {
+		return err
+	}
+
+	v := funcs.version()
+	if built := funcs.buildVersion(); !compatibleVersion(built, v) {
+		return &LoadError{Op: "version", Path: source, Err: &VersionMismatchError{Built: built, Loaded: v}}
+	}
+
+	newModel = funcs.newModel
+	version = v
+	model.SetVersion(version)
+	loaded = true
+	return nil
+}
+
+// Loaded reports whether the engine has been loaded.
+func Loaded() bool {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	return loaded
+}
+
+// compatibleVersion reports whether the engine built against libdeepspeech
+// built can load loaded: both share the same major and minor version, or
+// loaded is a later release keeping the C API of built.
+func compatibleVersion(built, loaded string) bool {
+	built, loaded = majorMinor(built), majorMinor(loaded)
+	if built == loaded {
+		return true
+	}
+	for _, v := range compatibleReleases[built] {
+		if v == loaded {
+			return true
+		}
+	}
+	return false
+}
+
+// compatibleReleases are the later releases keeping the C API of a release.
+// 0.8 and 0.9 only add functions to 0.7, e.g. the hot-word API of 0.9.
+var compatibleReleases = map[string][]string{
+	"0.7": {"0.8", "0.9"},
+}
+
+func majorMinor(v string) string {
+	v = strings.TrimPrefix(v, "v")
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) < 2 {
+		return v
+	}
+	return parts[0] + "." + parts[1]
+}
@@ -0,0 +1,17 @@
+// +build deepspeech_cgo
+
+package deepspeech
+
+import (
+	"github.com/mologix-co/deepspeech-go/engine"
+)
+
+// openEngine returns the engine linked in with cgo. LoadOptions only apply to
+// the plugin backend and are ignored.
+func openEngine(opts LoadOptions) (engineFuncs, string, error) {
+	return engineFuncs{
+		newModel:     engine.New,
+		version:      engine.Version,
+		buildVersion: engine.BuildVersion,
+	}, "libdeepspeech", nil
+}
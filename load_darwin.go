@@ -1,7 +1,10 @@
-// +build darwin
+// +build darwin,!deepspeech_system,!deepspeech_cgo
 
 package deepspeech
 
-func load() {
-	extract("/engine/deepspeech_plugin.dylib", "/engine/mac/libdeepspeech.so")
+func load(dir string, lib bool) (string, error) {
+	if !lib {
+		return extract(dir, "/engine/deepspeech_plugin.dylib", "")
+	}
+	return extract(dir, "/engine/deepspeech_plugin.dylib", "/engine/mac/libdeepspeech.so")
 }
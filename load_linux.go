@@ -1,7 +1,10 @@
-// +build linux
+// +build linux,!deepspeech_system,!deepspeech_cgo
 
 package deepspeech
 
-func load() {
-	extract("/engine/deepspeech_plugin.so", "/engine/linux/libdeepspeech.so")
+func load(dir string, lib bool) (string, error) {
+	if !lib {
+		return extract(dir, "/engine/deepspeech_plugin.so", "")
+	}
+	return extract(dir, "/engine/deepspeech_plugin.so", "/engine/linux/libdeepspeech.so")
 }
@@ -0,0 +1,73 @@
+// +build !deepspeech_cgo
+
+package deepspeech
+
+import (
+	"plugin"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// openEngine extracts the parts of the embedded engine whose paths were not
+// given, then opens the plugin and looks up its entry points. It returns the
+// plugin path.
+func openEngine(opts LoadOptions) (engineFuncs, string, error) {
+	var funcs engineFuncs
+	if opts.LibPath != "" {
+		if err := preload(opts.LibPath); err != nil {
+			return funcs, "", &LoadError{Op: "open", Path: opts.LibPath, Err: err}
+		}
+	}
+
+	pluginPath := opts.PluginPath
+	if pluginPath == "" {
+		if opts.Dir == "" {
+			dir, err := DefaultCacheDir()
+			if err != nil {
+				return funcs, "", &LoadError{Op: "extract", Path: EnvCacheDir, Err: err}
+			}
+			opts.Dir = dir
+		}
+
+		var err error
+		pluginPath, err = load(opts.Dir, opts.LibPath == "")
+		if err != nil {
+			return funcs, "", err
+		}
+	}
+
+	lib, err := plugin.Open(pluginPath)
+	if err != nil {
+		return funcs, "", &LoadError{Op: "open", Path: pluginPath, Err: err}
+	}
+
+	symbol, err := lib.Lookup("New")
+	if err != nil {
+		return funcs, "", &LoadError{Op: "lookup", Path: "New", Err: err}
+	}
+	var ok bool
+	funcs.newModel, ok = symbol.(func(string, uint32) (model.Model, error))
+	if !ok {
+		return funcs, "", &LoadError{Op: "lookup", Path: "New", Err: ErrSignature}
+	}
+
+	if funcs.version, err = lookupString(lib, "Version"); err != nil {
+		return funcs, "", err
+	}
+	if funcs.buildVersion, err = lookupString(lib, "BuildVersion"); err != nil {
+		return funcs, "", err
+	}
+	return funcs, pluginPath, nil
+}
+
+func lookupString(lib *plugin.Plugin, name string) (func() string, error) {
+	symbol, err := lib.Lookup(name)
+	if err != nil {
+		return nil, &LoadError{Op: "lookup", Path: name, Err: err}
+	}
+	fn, ok := symbol.(func() string)
+	if !ok {
+		return nil, &LoadError{Op: "lookup", Path: name, Err: ErrSignature}
+	}
+	return fn, nil
+}
@@ -0,0 +1,46 @@
+// +build !deepspeech_cgo
+
+package deepspeech
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad_Retry(t *testing.T) {
+	if Loaded() {
+		t.Skip("engine already loaded")
+	}
+	dir, err := ioutil.TempDir("", "deepspeech")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		opts LoadOptions
+		path string
+	}{
+		{LoadOptions{Dir: dir, PluginPath: filepath.Join(dir, "missing.so")}, filepath.Join(dir, "missing.so")},
+		{LoadOptions{Dir: dir, PluginPath: filepath.Join(dir, "missing.so"), LibPath: filepath.Join(dir, "libmissing.so")}, filepath.Join(dir, "libmissing.so")},
+	}
+	for _, tt := range tests {
+		// A failed load is not remembered, so it fails the same way again.
+		for i := 0; i < 2; i++ {
+			err := Load(tt.opts)
+			var loadErr *LoadError
+			if !errors.As(err, &loadErr) || loadErr.Op != "open" || loadErr.Path != tt.path {
+				t.Fatalf("Load(%+v) = %v, want an open LoadError for %s", tt.opts, err, tt.path)
+			}
+			if Loaded() {
+				t.Fatal("Loaded after a failed load")
+			}
+		}
+	}
+	if v := Version(); v != notLoaded {
+		t.Errorf("Version = %q, want %q", v, notLoaded)
+	}
+}
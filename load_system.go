@@ -0,0 +1,10 @@
+// +build deepspeech_system,!deepspeech_cgo
+
+package deepspeech
+
+// Built with the deepspeech_system tag the engine libraries are not embedded,
+// so the plugin must be given through LoadOptions.PluginPath or
+// $DEEPSPEECH_PLUGIN_PATH and libdeepspeech is taken from the system.
+func load(dir string, lib bool) (string, error) {
+	return "", &LoadError{Op: "extract", Path: EnvPluginPath, Err: ErrNotEmbedded}
+}
@@ -0,0 +1,106 @@
+package deepspeech
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+func TestCompatibleVersion(t *testing.T) {
+	tests := []struct {
+		built, loaded string
+		want          bool
+	}{
+		{"0.7.4", "0.7.4", true},
+		{"0.7.4", "0.7.0", true},
+		{"0.7.4", "v0.7.1-alpha.2", true},
+		{"v0.7.4", "0.7", true},
+		{"0.7.4", "0.8.2", true},
+		{"0.7.4", "0.9.3", true},
+		{"0.7.4", "0.6.1", false},
+		{"0.7.4", "0.10.0", false},
+		{"0.9.3", "0.7.4", false},
+		{"0.7.4", "1.7.4", false},
+		{"0.7.4", "0.70.0", false},
+		{"0.7.4", notLoaded, false},
+		{"0.7.4", "", false},
+	}
+	for _, tt := range tests {
+		if got := compatibleVersion(tt.built, tt.loaded); got != tt.want {
+			t.Errorf("compatibleVersion(%q, %q) = %v, want %v", tt.built, tt.loaded, got, tt.want)
+		}
+	}
+}
+
+func TestHotWordsSupported(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"0.7.4", false},
+		{"0.8.2", false},
+		{"0.9.0", true},
+		{"v0.9.3", true},
+		{"0.9.0-alpha.1", true},
+		{"0.10.0", true},
+		{"1.0.0", true},
+		{notLoaded, false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := model.HotWordsSupported(tt.version); got != tt.want {
+			t.Errorf("HotWordsSupported(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	mismatch := &VersionMismatchError{Built: "0.7.4", Loaded: "0.6.1"}
+	tests := []struct {
+		err  *LoadError
+		text string
+		is   error
+	}{
+		{
+			&LoadError{Op: "extract", Path: "lib", Err: ErrChecksum},
+			"deepspeech: extract lib: deepspeech: checksum mismatch",
+			ErrChecksum,
+		},
+		{
+			&LoadError{Op: "lookup", Path: "New", Err: ErrSignature},
+			"deepspeech: lookup New: deepspeech: plugin symbol signature mismatch",
+			ErrSignature,
+		},
+		{
+			&LoadError{Op: "open", Path: "plugin.so", Err: &os.PathError{Op: "open", Path: "plugin.so", Err: os.ErrNotExist}},
+			"deepspeech: open plugin.so: open plugin.so: file does not exist",
+			os.ErrNotExist,
+		},
+		{
+			&LoadError{Op: "version", Path: "plugin.so", Err: mismatch},
+			"deepspeech: version plugin.so: libdeepspeech version 0.6.1 does not match version 0.7.4 the engine was built against",
+			mismatch,
+		},
+	}
+	for _, tt := range tests {
+		var err error = tt.err
+		if text := err.Error(); text != tt.text {
+			t.Errorf("Error() = %q, want %q", text, tt.text)
+		}
+		if !errors.Is(err, tt.is) {
+			t.Errorf("errors.Is(%v, %v) = false", err, tt.is)
+		}
+		var loadErr *LoadError
+		if !errors.As(err, &loadErr) || loadErr != tt.err {
+			t.Errorf("errors.As(%v) did not find the LoadError", err)
+		}
+	}
+
+	var err error = &LoadError{Op: "version", Path: "plugin.so", Err: mismatch}
+	var got *VersionMismatchError
+	if !errors.As(err, &got) || got.Built != "0.7.4" || got.Loaded != "0.6.1" {
+		t.Errorf("errors.As(%v) = %+v, want the VersionMismatchError", err, got)
+	}
+}
@@ -0,0 +1,173 @@
+package model
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// Admission limits concurrent streams. Open streams and SpeechToText calls in
+// progress each take a slot.
+type Admission struct {
+	// MaxStreams is the number of slots. Zero means no limit and AdmitNone no
+	// slots at all.
+	MaxStreams int
+	// MaxQueue is the number of callers allowed to wait for a slot. Zero
+	// fails fast with ErrTooManyStreams when no slot is free.
+	MaxQueue int
+}
+
+// AdmitNone as Admission.MaxStreams admits nothing, whatever MaxQueue, e.g. on
+// a Pool instance left without a share of the pool's limit.
+const AdmitNone = -1
+
+// AdmissionStats are the counters of a Gate.
+type AdmissionStats struct {
+	Admission
+	// Active is the number of slots in use.
+	Active int
+	// Queued is the number of callers waiting for a slot.
+	Queued int
+	// Admitted counts admissions, including those that waited.
+	Admitted uint64
+	// Rejected counts callers turned away because the queue was full.
+	Rejected uint64
+	// Waited counts admissions that waited in the queue, and WaitTime is
+	// their total wait.
+	Waited   uint64
+	WaitTime time.Duration
+}
+
+// Gate enforces an Admission for Model implementations. Waiters are admitted
+// in order. The zero value has no limits.
+type Gate struct {
+	limits  Admission
+	active  int
+	waiters []chan error
+	closed  bool
+	stats   AdmissionStats
+	mu      sync.Mutex
+}
+
+// Set changes the limits. Waiters beyond a smaller queue are rejected.
+func (g *Gate) Set(limits Admission) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.limits = limits
+	g.admit()
+	if g.limits.MaxStreams != 0 {
+		for len(g.waiters) > g.queue() {
+			last := len(g.waiters) - 1
+			g.waiters[last] <- ErrTooManyStreams
+			g.waiters = g.waiters[:last]
+			g.stats.Rejected++
+		}
+	}
+}
+
+// Acquire takes a slot, waiting for one until ctx is done if the queue has
+// room. It returns os.ErrClosed once the gate is closed.
+func (g *Gate) Acquire(ctx context.Context) error {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return os.ErrClosed
+	}
+	if g.free() && len(g.waiters) == 0 {
+		g.active++
+		g.stats.Admitted++
+		g.mu.Unlock()
+		return nil
+	}
+	if len(g.waiters) >= g.queue() {
+		g.stats.Rejected++
+		g.mu.Unlock()
+		return ErrTooManyStreams
+	}
+	w := make(chan error, 1)
+	g.waiters = append(g.waiters, w)
+	g.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case err := <-w:
+		if err == nil {
+			g.mu.Lock()
+			g.stats.Waited++
+			g.stats.WaitTime += time.Since(start)
+			g.mu.Unlock()
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, other := range g.waiters {
+		if other == w {
+			g.waiters = append(g.waiters[:i], g.waiters[i+1:]...)
+			return ctx.Err()
+		}
+	}
+	// Admitted or rejected meanwhile; give the slot back.
+	if err := <-w; err == nil {
+		g.active--
+		g.admit()
+	}
+	return ctx.Err()
+}
+
+// Release frees a slot taken by Acquire.
+func (g *Gate) Release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.active--
+	g.admit()
+}
+
+// Close rejects waiting and later callers with os.ErrClosed. Slots in use
+// can still be released.
+func (g *Gate) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+	for _, w := range g.waiters {
+		w <- os.ErrClosed
+	}
+	g.waiters = nil
+}
+
+// Stats returns the current counters.
+func (g *Gate) Stats() AdmissionStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stats := g.stats
+	stats.Admission = g.limits
+	stats.Active = g.active
+	stats.Queued = len(g.waiters)
+	return stats
+}
+
+// free reports whether a slot is free. g.mu must be held.
+func (g *Gate) free() bool {
+	return g.limits.MaxStreams == 0 || g.active < g.limits.MaxStreams
+}
+
+// queue returns the number of callers allowed to wait. g.mu must be held.
+func (g *Gate) queue() int {
+	if g.limits.MaxStreams < 0 {
+		return 0
+	}
+	return g.limits.MaxQueue
+}
+
+// admit hands free slots to waiters. g.mu must be held.
+func (g *Gate) admit() {
+	for len(g.waiters) > 0 && g.free() {
+		g.waiters[0] <- nil
+		g.waiters = g.waiters[1:]
+		g.active++
+		g.stats.Admitted++
+	}
+}
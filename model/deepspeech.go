@@ -1,7 +1,11 @@
 package model
 
 import (
+	"context"
 	"errors"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,31 +18,172 @@ const (
 type Model interface {
 	EnableExternalScorer(path string, aAlpha, aBeta float32) error
 
+	// DisableExternalScorer switches to acoustic-only decoding.
+	// It returns ErrScorerNotEnabled if no scorer is enabled.
+	DisableExternalScorer() error
+
+	// SetScorerAlphaBeta sets the language model weight and the word insertion
+	// weight. It returns ErrScorerNotEnabled if no scorer is enabled.
+	SetScorerAlphaBeta(aAlpha, aBeta float32) error
+
+	ScorerEnabled() bool
+
+	// AddHotWord boosts (or, with a negative boost, suppresses) word. As in
+	// libdeepspeech 0.9, hot words need an enabled scorer, or the hot-word
+	// methods return ErrScorerNotEnabled, and are kept when the scorer is
+	// disabled or changed. AddHotWord returns ErrFailInsertHotWord for a word
+	// already added. The native engine returns ErrUnsupported unless the
+	// loaded libdeepspeech is 0.9 or later, see HotWordsSupported.
+	AddHotWord(word string, boost float32) error
+
+	// EraseHotWord returns ErrFailEraseHotWord for a word not added.
+	EraseHotWord(word string) error
+
+	ClearHotWords() error
+
 	SampleRate() int
 
+	BeamWidth() uint32
+
+	// SetBeamWidth changes the decoder beam width for streams created
+	// afterwards.
+	SetBeamWidth(beamWidth uint32) error
+
+	// Info describes the model's current configuration.
+	Info() Info
+
 	Close() error
 
-	SpeechToText(frame []int16) string
+	// CloseContext stops accepting new streams and SpeechToText calls, waits
+	// for the open streams to finish and closes the model. If ctx is done
+	// first the remaining streams are freed and ctx.Err() is returned; the
+	// model is closed either way.
+	CloseContext(ctx context.Context) error
+
+	// Streams lists the open streams.
+	Streams() []StreamInfo
+
+	// SetIdleTimeout frees streams that were neither fed nor decoded for
+	// timeout and calls report, if not nil, for each of them. A timeout of
+	// zero disables it.
+	SetIdleTimeout(timeout time.Duration, report func(StreamInfo)) error
+
+	// SetLeakDetector records where streams created afterwards are created
+	// and calls report when one is garbage collected without being finished
+	// or freed. The stream is freed. A nil report disables it.
+	SetLeakDetector(report func(Leak)) error
 
+	// SetAdmission limits the number of open streams and SpeechToText calls.
+	SetAdmission(limits Admission) error
+
+	// AdmissionStats returns the admission counters.
+	AdmissionStats() AdmissionStats
+
+	// SetFeedQueue configures the Stream.FeedAsync queue of streams created
+	// afterwards.
+	SetFeedQueue(queue FeedQueue) error
+
+	// SpeechToText waits for a free slot when the stream limit is reached.
+	SpeechToText(frame []int16) (string, error)
+
+	// CreateStream is CreateStreamContext with context.Background().
 	CreateStream() (Stream, error)
+
+	// CreateStreamContext creates a stream, waiting in the queue until ctx is
+	// done when the stream limit is reached. It returns ErrTooManyStreams if
+	// the queue is full.
+	CreateStreamContext(ctx context.Context) (Stream, error)
 }
 
+// Stream is a streaming inference. Its methods are safe for concurrent use and
+// return os.ErrClosed once the stream was finished or freed.
 type Stream interface {
 	Free() error
 
-	IntermediateDecode() string
+	IntermediateDecode() (string, error)
+
+	FeedAudioContent(frame []int16) error
 
-	FeedAudioContent(frame []int16)
+	// FeedAsync queues a copy of frame to be fed by a goroutine of the stream,
+	// so the caller does not wait for inference. Frames are fed in order;
+	// the other methods, except Free and QueueStats, wait for the queue
+	// first. Once a queued frame failed, FeedAsync returns its error.
+	FeedAsync(frame []int16) error
 
-	IntermediateDecodeWithMetadata(aNumResults uint32) *Metadata
+	// Flush waits until the frames queued by FeedAsync were fed.
+	Flush() error
 
-	FinishStream() string
+	// QueueStats returns the FeedAsync queue counters.
+	QueueStats() QueueStats
 
-	FinishStreamWithMetadata(aNumResults uint32) *Metadata
+	IntermediateDecodeWithMetadata(aNumResults uint32) (*Metadata, error)
 
-	FinishStreamWithBestHypothesis(aNumResults uint32) *HypothesisCandidate
+	FinishStream() (string, error)
 
-	FinishStreamWithHypothesis(aNumResults uint32) Hypothesis
+	FinishStreamWithMetadata(aNumResults uint32) (*Metadata, error)
+
+	FinishStreamWithBestHypothesis(aNumResults uint32) (*HypothesisCandidate, error)
+
+	FinishStreamWithHypothesis(aNumResults uint32) (Hypothesis, error)
+}
+
+// Info describes how a Model is configured.
+type Info struct {
+	SampleRate    int
+	BeamWidth     uint32
+	ScorerEnabled bool
+	ScorerPath    string
+	Alpha         float32
+	Beta          float32
+	// Version is the libdeepspeech version.
+	Version   string
+	ModelPath string
+	// ModelSize is the size of the model file in bytes.
+	ModelSize   int64
+	OpenStreams int
+	// AudioFed and DecodeTime are totals over all streams and SpeechToText
+	// calls since the model was opened. DecodeTime is the wall time spent in
+	// the engine.
+	AudioFed   time.Duration
+	DecodeTime time.Duration
+}
+
+// StreamInfo describes an open stream.
+type StreamInfo struct {
+	ID      uint64
+	Created time.Time
+	// LastActivity is the time of the last feed or decode.
+	LastActivity time.Time
+	// AudioFed is the duration of audio fed so far.
+	AudioFed time.Duration
+	// DecodeTime is the wall time spent feeding and decoding.
+	DecodeTime time.Duration
+}
+
+// RealTimeFactor returns the decode time per second of audio fed, or zero if
+// no audio was fed. Below 1 the stream decodes faster than real time.
+func (s StreamInfo) RealTimeFactor() float64 {
+	if s.AudioFed <= 0 {
+		return 0
+	}
+	return float64(s.DecodeTime) / float64(s.AudioFed)
+}
+
+// Leak describes a stream garbage collected while still open.
+type Leak struct {
+	StreamInfo
+	// Stack is the stack trace of the CreateStream call.
+	Stack []byte
+}
+
+// SortStreams sorts streams by creation time and ID.
+func SortStreams(streams []StreamInfo) {
+	sort.Slice(streams, func(i, j int) bool {
+		if !streams[i].Created.Equal(streams[j].Created) {
+			return streams[i].Created.Before(streams[j].Created)
+		}
+		return streams[i].ID < streams[j].ID
+	})
 }
 
 type TokenMetadata struct {
@@ -107,8 +252,21 @@ var (
 	ErrFailCreateSess   = errFailCreateSess(0x3006)
 	ErrFailCreateModel  = errFailCreateModel(0x3007)
 
+	// Hot-word failures (libdeepspeech 0.9+)
+	ErrFailInsertHotWord = errFailInsertHotWord(0x3008)
+	ErrFailClearHotWord  = errFailClearHotWord(0x3009)
+	ErrFailEraseHotWord  = errFailEraseHotWord(0x3010)
+
 	ErrOpenStreams = errors.New("open streams")
 
+	// ErrTooManyStreams is returned when the stream limit is reached and the
+	// wait queue is full. See Admission.
+	ErrTooManyStreams = errors.New("too many streams")
+
+	// ErrUnsupported is returned for features the loaded libdeepspeech
+	// version does not provide.
+	ErrUnsupported = errors.New("unsupported by this libdeepspeech version")
+
 	version = ""
 )
 
@@ -120,6 +278,25 @@ func SetVersion(v string) {
 	version = v
 }
 
+// HotWordsSupported reports whether libdeepspeech version v has the hot-word
+// API, which was added in 0.9.
+func HotWordsSupported(v string) bool {
+	v = strings.TrimPrefix(v, "v")
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(strings.SplitN(parts[1], "-", 2)[0])
+	if err != nil {
+		return false
+	}
+	return major > 0 || minor >= 9
+}
+
 func ErrorOf(code int) error {
 	if code == 0 {
 		return nil
@@ -164,6 +341,12 @@ func ErrorOf(code int) error {
 		return ErrFailCreateSess
 	case 0x3007:
 		return ErrFailCreateModel
+	case 0x3008:
+		return ErrFailInsertHotWord
+	case 0x3009:
+		return ErrFailClearHotWord
+	case 0x3010:
+		return ErrFailEraseHotWord
 	}
 	return Error(code)
 }
@@ -262,3 +445,15 @@ func (errFailCreateSess) Error() string { return "Failed to create session." }
 type errFailCreateModel Error
 
 func (errFailCreateModel) Error() string { return "Could not allocate model state." }
+
+type errFailInsertHotWord Error
+
+func (errFailInsertHotWord) Error() string { return "Could not insert hot-word." }
+
+type errFailClearHotWord Error
+
+func (errFailClearHotWord) Error() string { return "Could not clear hot-words." }
+
+type errFailEraseHotWord Error
+
+func (errFailEraseHotWord) Error() string { return "Could not erase hot-word." }
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultQueueSize is the FeedQueue size used when Size is zero.
+const DefaultQueueSize = 64
+
+// QueuePolicy says what Stream.FeedAsync does when the feed queue is full.
+type QueuePolicy int
+
+const (
+	// QueueBlock waits for room in the queue.
+	QueueBlock QueuePolicy = iota
+	// QueueDropOldest discards the oldest queued frame.
+	QueueDropOldest
+	// QueueError fails with ErrQueueFull.
+	QueueError
+)
+
+// ErrQueueFull is returned by Stream.FeedAsync when the queue is full and its
+// policy is QueueError.
+var ErrQueueFull = errors.New("feed queue full")
+
+// FeedQueue configures the queue of frames fed with Stream.FeedAsync.
+type FeedQueue struct {
+	// Size is the number of frames queued. Zero means DefaultQueueSize.
+	Size   int
+	Policy QueuePolicy
+}
+
+// QueueStats are the counters of an AsyncFeeder.
+type QueueStats struct {
+	FeedQueue
+	// Queued is the number of frames waiting to be fed.
+	Queued int
+	// Fed counts frames fed, Dropped those discarded by QueueDropOldest and
+	// Rejected those refused by QueueError.
+	Fed      uint64
+	Dropped  uint64
+	Rejected uint64
+	// Lag is how long the oldest queued frame has been waiting. MaxLag and
+	// TotalLag are the longest and the total wait of the frames fed.
+	Lag      time.Duration
+	MaxLag   time.Duration
+	TotalLag time.Duration
+}
+
+type queuedFrame struct {
+	audio  []int16
+	queued time.Time
+}
+
+// AsyncFeeder implements Stream.FeedAsync and Stream.Flush for Model
+// implementations. Frames are fed in order by a goroutine locked to an OS
+// thread, started with the first frame and stopped by Close.
+type AsyncFeeder struct {
+	feed    func([]int16) error
+	config  FeedQueue
+	frames  []queuedFrame
+	started bool
+	// busy is set while a frame is fed.
+	busy   bool
+	closed bool
+	// err is the first error returned by feed.
+	err   error
+	stats QueueStats
+	cond  sync.Cond
+	mu    sync.Mutex
+}
+
+// NewAsyncFeeder returns an AsyncFeeder passing frames to feed, which must not
+// wait for the feeder.
+func NewAsyncFeeder(config FeedQueue, feed func(frame []int16) error) *AsyncFeeder {
+	if config.Size <= 0 {
+		config.Size = DefaultQueueSize
+	}
+	f := &AsyncFeeder{feed: feed, config: config}
+	f.cond.L = &f.mu
+	f.stats.FeedQueue = config
+	return f
+}
+
+// Feed queues a copy of frame. After feed failed, Feed returns its error.
+func (f *AsyncFeeder) Feed(frame []int16) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		if f.closed {
+			return os.ErrClosed
+		}
+		if f.err != nil {
+			return f.err
+		}
+		if len(f.frames) < f.config.Size {
+			break
+		}
+		switch f.config.Policy {
+		case QueueDropOldest:
+			f.frames[0] = queuedFrame{}
+			f.frames = f.frames[1:]
+			f.stats.Dropped++
+		case QueueError:
+			f.stats.Rejected++
+			return ErrQueueFull
+		default:
+			f.cond.Wait()
+		}
+	}
+
+	f.frames = append(f.frames, queuedFrame{
+		audio:  append([]int16(nil), frame...),
+		queued: time.Now(),
+	})
+	if !f.started {
+		f.started = true
+		go f.run()
+	}
+	f.cond.Broadcast()
+	return nil
+}
+
+// Flush waits until the queued frames were fed. It returns the error of the
+// first frame that failed, or os.ErrClosed after Close.
+func (f *AsyncFeeder) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for !f.closed && f.err == nil && (len(f.frames) > 0 || f.busy) {
+		f.cond.Wait()
+	}
+	if f.closed {
+		return os.ErrClosed
+	}
+	return f.err
+}
+
+// Close discards the queued frames and stops the goroutine once the frame
+// being fed is done. It does not wait.
+func (f *AsyncFeeder) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	f.frames = nil
+	f.cond.Broadcast()
+}
+
+func (f *AsyncFeeder) Stats() QueueStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := f.stats
+	stats.Queued = len(f.frames)
+	if len(f.frames) > 0 {
+		stats.Lag = time.Since(f.frames[0].queued)
+	}
+	return stats
+}
+
+func (f *AsyncFeeder) run() {
+	// Inference runs on one thread, as with FeedAudioContent on a caller's
+	// goroutine.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		for !f.closed && len(f.frames) == 0 {
+			f.cond.Wait()
+		}
+		if f.closed {
+			return
+		}
+		frame := f.frames[0]
+		f.frames[0] = queuedFrame{}
+		f.frames = f.frames[1:]
+		lag := time.Since(frame.queued)
+		f.stats.TotalLag += lag
+		if lag > f.stats.MaxLag {
+			f.stats.MaxLag = lag
+		}
+		f.busy = true
+		// Room for a blocked Feed.
+		f.cond.Broadcast()
+		f.mu.Unlock()
+
+		err := f.feed(frame.audio)
+
+		f.mu.Lock()
+		f.busy = false
+		f.stats.Fed++
+		if err != nil && f.err == nil {
+			f.err = err
+			f.frames = nil
+		}
+		f.cond.Broadcast()
+	}
+}
@@ -0,0 +1,164 @@
+package model
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// NewHypothesis groups the tokens of each transcript in m into words.
+func NewHypothesis(m *Metadata) Hypothesis {
+	candidates := make([]HypothesisCandidate, len(m.Transcripts))
+	for i, c := range m.Transcripts {
+		candidates[i] = newHypothesisCandidate(&c)
+	}
+	return Hypothesis{
+		Candidates: candidates,
+	}
+}
+
+func newHypothesisCandidate(m *CandidateTranscript) HypothesisCandidate {
+	isWhitespace := true
+	startStep := 0
+	startTime := time.Duration(0)
+	hyp := HypothesisCandidate{
+		Confidence: m.Confidence,
+		Words:      make([]Word, 0, 8),
+	}
+
+	items := m.Tokens
+	text := strings.Builder{}
+	wordBuf := strings.Builder{}
+
+	lastIndex := len(items) - 1
+	for i, item := range items {
+		if i == 0 {
+			startStep = item.Timestep
+			startTime = time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime)))
+		}
+
+		c := item.Text
+
+		text.WriteString(c)
+
+		// Trim whitespace.
+		c = strings.TrimSpace(c)
+
+		// Is it whitespace?
+		if len(c) == 0 {
+			// End of word?
+			if !isWhitespace {
+				isWhitespace = true
+				// Only if not first character.
+				if i > 0 {
+					endStep := item.Timestep
+					endTime := time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime)))
+					w := Word{
+						Whitespace: false,
+						Value:      wordBuf.String(),
+						StartStep:  startStep,
+						EndStep:    endStep,
+						StartTime:  startTime,
+						EndTime:    endTime,
+					}
+					w.Duration = w.EndTime - w.StartTime
+					hyp.Words = append(hyp.Words, w)
+
+					w.StartStep = w.EndStep + 1
+					w.StartTime = w.EndTime
+
+					wordBuf.Reset()
+				} else if i == lastIndex {
+					//w := Word{
+					//	Whitespace: false,
+					//	Value:      wordBuf.String(),
+					//	StartStep:  startStep,
+					//	EndStep:    item.Timestep(),
+					//	StartTime:  startTime,
+					//	EndTime:    time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime()))),
+					//}
+					//w.Duration = w.EndTime - w.StartTime
+					//hyp.Words = append(hyp.Words, w)
+				}
+
+				startStep = item.Timestep
+				startTime = time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime)))
+			} else if i == lastIndex {
+				//w := Word{
+				//	Whitespace: true,
+				//	Value:      "",
+				//	StartStep:  startStep,
+				//	EndStep:    item.Timestep,
+				//	StartTime:  startTime,
+				//	EndTime:    time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime))),
+				//}
+				//w.Duration = w.EndTime - w.StartTime
+				//hyp.Words = append(hyp.Words, w)
+			}
+		} else {
+			wordBuf.WriteString(c)
+
+			// End of whitespace?
+			if isWhitespace {
+
+				isWhitespace = false
+				// Only if not first character.
+				if i > 0 {
+					//w := Word{
+					//	Whitespace: true,
+					//	Value:      "",
+					//	StartStep:  startStep,
+					//	EndStep:    item.Timestep,
+					//	StartTime:  startTime,
+					//	EndTime:    time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime))),
+					//}
+					//w.Duration = w.EndTime - w.StartTime
+					//hyp.Words = append(hyp.Words, w)
+					//startStep = w.EndStep
+					//startTime = w.EndTime
+
+					startStep = item.Timestep
+					startTime = time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime)))
+				} else if i == lastIndex {
+					w := Word{
+						Whitespace: false,
+						Value:      wordBuf.String(),
+						StartStep:  startStep,
+						EndStep:    item.Timestep,
+						StartTime:  startTime,
+						EndTime:    time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime))),
+					}
+					w.Duration = w.EndTime - w.StartTime
+					hyp.Words = append(hyp.Words, w)
+				}
+
+				startStep = item.Timestep
+				startTime = time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime)))
+			} else if i == lastIndex {
+				w := Word{
+					Whitespace: false,
+					Value:      wordBuf.String(),
+					StartStep:  startStep,
+					EndStep:    item.Timestep,
+					StartTime:  startTime,
+					EndTime:    time.Duration(math.RoundToEven(float64(time.Second) * float64(item.StartTime))),
+				}
+				w.Duration = w.EndTime - w.StartTime
+				hyp.Words = append(hyp.Words, w)
+			}
+		}
+	}
+
+	hyp.Text = text.String()
+	if len(hyp.Words) > 0 {
+		first := hyp.Words[0]
+		last := hyp.Words[len(hyp.Words)-1]
+		hyp.StartStep = first.StartStep
+		hyp.StartTime = first.StartTime
+		hyp.EndStep = last.EndStep
+		hyp.EndTime = last.EndTime
+		hyp.Duration = hyp.EndTime - hyp.StartTime
+	}
+
+	return hyp
+}
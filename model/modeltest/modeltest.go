@@ -0,0 +1,736 @@
+// Package modeltest provides a conformance suite for model.Model
+// implementations, checking they follow the lifecycle and result shape of the
+// engine.
+//
+// A wrapper or fake is verified by running the suite from a test:
+//
+//	func TestConformance(t *testing.T) {
+//		modeltest.Run(t, func(t *testing.T) model.Model {
+//			return newWrapper(...)
+//		})
+//	}
+package modeltest
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// Factory returns a fresh Model for a single subtest. The suite closes it.
+type Factory func(t *testing.T) model.Model
+
+// FinishFailer is implemented by models that can make the next FinishStream
+// fail, like deepspeechtest.Model. The suite then checks that a failed finish
+// frees the stream, as the engine does.
+type FinishFailer interface {
+	FailNextFinish(err error)
+}
+
+// NumResults is the number of candidates requested from metadata calls.
+const NumResults = 5
+
+// Run runs the conformance suite against models returned by factory.
+func Run(t *testing.T, factory Factory) {
+	t.Run("CloseWithOpenStreams", func(t *testing.T) { testCloseWithOpenStreams(t, factory) })
+	t.Run("CloseTwice", func(t *testing.T) { testCloseTwice(t, factory) })
+	t.Run("CreateStreamAfterClose", func(t *testing.T) { testCreateStreamAfterClose(t, factory) })
+	t.Run("CloseContextDrain", func(t *testing.T) { testCloseContextDrain(t, factory) })
+	t.Run("CloseContextForce", func(t *testing.T) { testCloseContextForce(t, factory) })
+	t.Run("Streams", func(t *testing.T) { testStreams(t, factory) })
+	t.Run("IdleTimeout", func(t *testing.T) { testIdleTimeout(t, factory) })
+	t.Run("Admission", func(t *testing.T) { testAdmission(t, factory) })
+	t.Run("FeedAsync", func(t *testing.T) { testFeedAsync(t, factory) })
+	t.Run("SpeechToText", func(t *testing.T) { testSpeechToText(t, factory) })
+	t.Run("DisableExternalScorer", func(t *testing.T) { testDisableExternalScorer(t, factory) })
+	t.Run("HotWords", func(t *testing.T) { testHotWords(t, factory) })
+	t.Run("Info", func(t *testing.T) { testInfo(t, factory) })
+	t.Run("FreeTwice", func(t *testing.T) { testFreeTwice(t, factory) })
+	t.Run("UseAfterFree", func(t *testing.T) { testUseAfterFree(t, factory) })
+	t.Run("UseAfterFinish", func(t *testing.T) { testUseAfterFinish(t, factory) })
+	t.Run("FinishError", func(t *testing.T) { testFinishError(t, factory) })
+	t.Run("ConcurrentCreateStream", func(t *testing.T) { testConcurrentCreateStream(t, factory) })
+	t.Run("MetadataShape", func(t *testing.T) { testMetadataShape(t, factory) })
+	t.Run("HypothesisWords", func(t *testing.T) { testHypothesisWords(t, factory) })
+}
+
+// Audio returns d of deterministic low-level noise at sampleRate.
+func Audio(sampleRate int, d time.Duration) []int16 {
+	n := int(int64(sampleRate) * int64(d) / int64(time.Second))
+	audio := make([]int16, n)
+	seed := uint32(1)
+	for i := range audio {
+		seed = seed*1664525 + 1013904223
+		audio[i] = int16(seed>>16) / 64
+	}
+	return audio
+}
+
+func open(t *testing.T, factory Factory) model.Model {
+	t.Helper()
+	m := factory(t)
+	if m == nil {
+		t.Fatal("factory returned nil Model")
+	}
+	return m
+}
+
+func closeModel(t *testing.T, m model.Model) {
+	t.Helper()
+	if err := m.Close(); err != nil && err != os.ErrClosed {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func createStream(t *testing.T, m model.Model) model.Stream {
+	t.Helper()
+	s, err := m.CreateStream()
+	if err != nil {
+		t.Fatalf("CreateStream: %v", err)
+	}
+	if s == nil {
+		t.Fatal("CreateStream returned nil Stream")
+	}
+	return s
+}
+
+func testCloseWithOpenStreams(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	s := createStream(t, m)
+	if err := m.Close(); err != model.ErrOpenStreams {
+		t.Fatalf("Close with an open stream: expected ErrOpenStreams, got %v", err)
+	}
+	if err := s.Free(); err != nil {
+		t.Fatalf("Free: %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close after Free: %v", err)
+	}
+}
+
+func testCloseTwice(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := m.Close(); err != os.ErrClosed {
+		t.Fatalf("second Close: expected os.ErrClosed, got %v", err)
+	}
+}
+
+func testCreateStreamAfterClose(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if s, err := m.CreateStream(); err != os.ErrClosed {
+		if s != nil {
+			_ = s.Free()
+		}
+		t.Fatalf("CreateStream after Close: expected os.ErrClosed, got %v", err)
+	}
+}
+
+func testCloseContextDrain(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	s := createStream(t, m)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.CloseContext(context.Background())
+	}()
+	// Wait until new streams are refused, i.e. the model is draining.
+	for deadline := time.Now().Add(time.Second); ; {
+		ns, err := m.CreateStream()
+		if err == os.ErrClosed {
+			break
+		}
+		if err == nil {
+			_ = ns.Free()
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("CreateStream while draining: expected os.ErrClosed, got %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("CloseContext returned with an open stream: %v", err)
+	default:
+	}
+	if _, err := s.FinishStream(); err != nil {
+		t.Fatalf("FinishStream while draining: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("CloseContext: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CloseContext did not return after the last stream finished")
+	}
+	if err := m.Close(); err != os.ErrClosed {
+		t.Fatalf("Close after CloseContext: expected os.ErrClosed, got %v", err)
+	}
+}
+
+func testCloseContextForce(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	s := createStream(t, m)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.CloseContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("CloseContext with an open stream: expected context.DeadlineExceeded, got %v", err)
+	}
+	checkClosed(t, "CloseContext", s)
+	if err := m.Close(); err != os.ErrClosed {
+		t.Fatalf("Close after CloseContext: expected os.ErrClosed, got %v", err)
+	}
+}
+
+func testStreams(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	if streams := m.Streams(); len(streams) != 0 {
+		t.Fatalf("Streams without streams: got %d", len(streams))
+	}
+	before := time.Now()
+	s1 := createStream(t, m)
+	s2 := createStream(t, m)
+	feed(t, s2, Audio(m.SampleRate(), time.Second))
+
+	streams := m.Streams()
+	if len(streams) != 2 {
+		t.Fatalf("Streams: expected 2, got %d", len(streams))
+	}
+	var fed time.Duration
+	for _, info := range streams {
+		if info.Created.Before(before) || info.LastActivity.Before(info.Created) {
+			t.Errorf("Streams: implausible times %+v", info)
+		}
+		fed += info.AudioFed
+	}
+	if fed != time.Second {
+		t.Errorf("Streams: expected 1s of audio fed, got %v", fed)
+	}
+
+	if err := s1.Free(); err != nil {
+		t.Fatalf("Free: %v", err)
+	}
+	if err := s2.Free(); err != nil {
+		t.Fatalf("Free: %v", err)
+	}
+	if streams := m.Streams(); len(streams) != 0 {
+		t.Fatalf("Streams after Free: expected none, got %d", len(streams))
+	}
+}
+
+func testIdleTimeout(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	reaped := make(chan model.StreamInfo, 1)
+	if err := m.SetIdleTimeout(20*time.Millisecond, func(info model.StreamInfo) {
+		reaped <- info
+	}); err != nil {
+		t.Fatalf("SetIdleTimeout: %v", err)
+	}
+	s := createStream(t, m)
+	select {
+	case <-reaped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle stream was not reported")
+	}
+	checkClosed(t, "idle timeout", s)
+	if err := m.SetIdleTimeout(0, nil); err != nil {
+		t.Fatalf("SetIdleTimeout(0): %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close after the idle stream was freed: %v", err)
+	}
+}
+
+func testAdmission(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	if err := m.SetAdmission(model.Admission{MaxStreams: 1}); err != nil {
+		t.Fatalf("SetAdmission: %v", err)
+	}
+	// Wrappers may admit MaxStreams per underlying model.
+	capacity := m.AdmissionStats().MaxStreams
+	if capacity < 1 {
+		t.Fatalf("AdmissionStats: expected MaxStreams >= 1, got %d", capacity)
+	}
+	streams := make([]model.Stream, capacity)
+	for i := range streams {
+		streams[i] = createStream(t, m)
+	}
+	if s, err := m.CreateStream(); err != model.ErrTooManyStreams {
+		if s != nil {
+			_ = s.Free()
+		}
+		t.Fatalf("CreateStream at the limit: expected ErrTooManyStreams, got %v", err)
+	}
+
+	if err := m.SetAdmission(model.Admission{MaxStreams: 1, MaxQueue: 1}); err != nil {
+		t.Fatalf("SetAdmission: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if s, err := m.CreateStreamContext(ctx); err != context.DeadlineExceeded {
+		if s != nil {
+			_ = s.Free()
+		}
+		t.Fatalf("CreateStreamContext at the limit: expected context.DeadlineExceeded, got %v", err)
+	}
+
+	type result struct {
+		s   model.Stream
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		s, err := m.CreateStreamContext(context.Background())
+		done <- result{s, err}
+	}()
+	for deadline := time.Now().Add(5 * time.Second); m.AdmissionStats().Queued == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("CreateStreamContext did not queue")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, s := range streams {
+		if err := s.Free(); err != nil {
+			t.Fatalf("Free: %v", err)
+		}
+	}
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("queued CreateStreamContext: %v", r.err)
+		}
+		if err := r.s.Free(); err != nil {
+			t.Fatalf("Free: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued CreateStreamContext was not admitted")
+	}
+
+	stats := m.AdmissionStats()
+	if stats.Active != 0 || stats.Queued != 0 || stats.Rejected == 0 || stats.Waited == 0 {
+		t.Errorf("AdmissionStats: unexpected %+v", stats)
+	}
+
+	if err := m.SetAdmission(model.Admission{MaxStreams: model.AdmitNone, MaxQueue: 1}); err != nil {
+		t.Fatalf("SetAdmission(AdmitNone): %v", err)
+	}
+	if s, err := m.CreateStream(); err != model.ErrTooManyStreams {
+		if s != nil {
+			_ = s.Free()
+		}
+		t.Fatalf("CreateStream with AdmitNone: expected ErrTooManyStreams, got %v", err)
+	}
+	if _, err := m.SpeechToText(Audio(m.SampleRate(), 100*time.Millisecond)); err != model.ErrTooManyStreams {
+		t.Fatalf("SpeechToText with AdmitNone: expected ErrTooManyStreams, got %v", err)
+	}
+}
+
+func testFeedAsync(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	if err := m.SetFeedQueue(model.FeedQueue{Size: 2}); err != nil {
+		t.Fatalf("SetFeedQueue: %v", err)
+	}
+	audio := Audio(m.SampleRate(), time.Second)
+	frame := m.SampleRate() / 50
+	direct, async := createStream(t, m), createStream(t, m)
+	frames := 0
+	for i := 0; i < len(audio); i += frame {
+		end := i + frame
+		if end > len(audio) {
+			end = len(audio)
+		}
+		feed(t, direct, audio[i:end])
+		if err := async.FeedAsync(audio[i:end]); err != nil {
+			t.Fatalf("FeedAsync: %v", err)
+		}
+		frames++
+	}
+	if err := async.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	stats := async.QueueStats()
+	if stats.Fed != uint64(frames) || stats.Queued != 0 || stats.Size != 2 {
+		t.Errorf("QueueStats: unexpected %+v after %d frames", stats, frames)
+	}
+
+	want, err := direct.FinishStream()
+	if err != nil {
+		t.Fatalf("FinishStream: %v", err)
+	}
+	if got, err := async.FinishStream(); err != nil || got != want {
+		t.Fatalf("FinishStream after FeedAsync = %q, %v; expected %q", got, err, want)
+	}
+	if err := async.FeedAsync(audio[:frame]); err != os.ErrClosed {
+		t.Fatalf("FeedAsync after FinishStream: expected os.ErrClosed, got %v", err)
+	}
+}
+
+func testSpeechToText(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	if _, err := m.SpeechToText(Audio(m.SampleRate(), time.Second)); err != nil {
+		t.Fatalf("SpeechToText: %v", err)
+	}
+	if _, err := m.SpeechToText(nil); err != nil {
+		t.Fatalf("SpeechToText without audio: %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := m.SpeechToText(Audio(m.SampleRate(), time.Second)); err != os.ErrClosed {
+		t.Fatalf("SpeechToText after Close: expected os.ErrClosed, got %v", err)
+	}
+}
+
+func testDisableExternalScorer(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	if m.ScorerEnabled() {
+		if err := m.DisableExternalScorer(); err != nil {
+			t.Fatalf("DisableExternalScorer: %v", err)
+		}
+		if m.ScorerEnabled() {
+			t.Fatal("ScorerEnabled after DisableExternalScorer")
+		}
+	}
+	if err := m.DisableExternalScorer(); err != model.ErrScorerNotEnabled {
+		t.Fatalf("DisableExternalScorer without scorer: expected ErrScorerNotEnabled, got %v", err)
+	}
+	if err := m.SetScorerAlphaBeta(0, 0); err != model.ErrScorerNotEnabled {
+		t.Fatalf("SetScorerAlphaBeta without scorer: expected ErrScorerNotEnabled, got %v", err)
+	}
+
+	s := createStream(t, m)
+	feed(t, s, Audio(m.SampleRate(), time.Second))
+	if _, err := s.FinishStream(); err != nil {
+		t.Fatalf("FinishStream without scorer: %v", err)
+	}
+}
+
+func testHotWords(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	err := m.AddHotWord("hello", 10)
+	if err == model.ErrUnsupported {
+		if err = m.EraseHotWord("hello"); err != model.ErrUnsupported {
+			t.Errorf("EraseHotWord: expected ErrUnsupported like AddHotWord, got %v", err)
+		}
+		if err = m.ClearHotWords(); err != model.ErrUnsupported {
+			t.Errorf("ClearHotWords: expected ErrUnsupported like AddHotWord, got %v", err)
+		}
+		return
+	}
+	if !m.ScorerEnabled() {
+		if err != model.ErrScorerNotEnabled {
+			t.Fatalf("AddHotWord without scorer: expected ErrScorerNotEnabled, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("AddHotWord: %v", err)
+	}
+	if err = m.AddHotWord("hello", 5); err != model.ErrFailInsertHotWord {
+		t.Fatalf("AddHotWord twice: expected ErrFailInsertHotWord, got %v", err)
+	}
+	if err = m.AddHotWord("world", -5); err != nil {
+		t.Fatalf("AddHotWord with negative boost: %v", err)
+	}
+
+	// Hot words need a scorer but are kept while it is disabled.
+	info := m.Info()
+	if err = m.DisableExternalScorer(); err != nil {
+		t.Fatalf("DisableExternalScorer: %v", err)
+	}
+	if err = m.EraseHotWord("hello"); err != model.ErrScorerNotEnabled {
+		t.Fatalf("EraseHotWord without scorer: expected ErrScorerNotEnabled, got %v", err)
+	}
+	if err = m.EnableExternalScorer(info.ScorerPath, info.Alpha, info.Beta); err != nil {
+		t.Fatalf("EnableExternalScorer: %v", err)
+	}
+	if err = m.AddHotWord("world", -5); err != model.ErrFailInsertHotWord {
+		t.Fatalf("AddHotWord after re-enabling the scorer: expected ErrFailInsertHotWord, got %v", err)
+	}
+
+	if err = m.EraseHotWord("hello"); err != nil {
+		t.Fatalf("EraseHotWord: %v", err)
+	}
+	if err = m.EraseHotWord("hello"); err != model.ErrFailEraseHotWord {
+		t.Fatalf("EraseHotWord twice: expected ErrFailEraseHotWord, got %v", err)
+	}
+	if err = m.ClearHotWords(); err != nil {
+		t.Fatalf("ClearHotWords: %v", err)
+	}
+	if err = m.AddHotWord("world", -5); err != nil {
+		t.Fatalf("AddHotWord after ClearHotWords: %v", err)
+	}
+}
+
+func testInfo(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	info := m.Info()
+	if info.SampleRate != m.SampleRate() {
+		t.Errorf("Info.SampleRate %d does not match SampleRate %d", info.SampleRate, m.SampleRate())
+	}
+	if info.BeamWidth != m.BeamWidth() {
+		t.Errorf("Info.BeamWidth %d does not match BeamWidth %d", info.BeamWidth, m.BeamWidth())
+	}
+	if info.ScorerEnabled != m.ScorerEnabled() {
+		t.Errorf("Info.ScorerEnabled %v does not match ScorerEnabled %v", info.ScorerEnabled, m.ScorerEnabled())
+	}
+	if info.OpenStreams != 0 {
+		t.Errorf("Info.OpenStreams: expected 0, got %d", info.OpenStreams)
+	}
+
+	const beamWidth = 123
+	if err := m.SetBeamWidth(beamWidth); err != nil {
+		t.Fatalf("SetBeamWidth: %v", err)
+	}
+	if m.BeamWidth() != beamWidth || m.Info().BeamWidth != beamWidth {
+		t.Errorf("BeamWidth after SetBeamWidth(%d): got %d, Info %d", beamWidth, m.BeamWidth(), m.Info().BeamWidth)
+	}
+
+	a := createStream(t, m)
+	b := createStream(t, m)
+	if n := m.Info().OpenStreams; n != 2 {
+		t.Errorf("Info.OpenStreams with 2 streams: got %d", n)
+	}
+	_ = a.Free()
+	_ = b.Free()
+	if n := m.Info().OpenStreams; n != 0 {
+		t.Errorf("Info.OpenStreams after Free: got %d", n)
+	}
+}
+
+func testFreeTwice(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	s := createStream(t, m)
+	if err := s.Free(); err != nil {
+		t.Fatalf("Free: %v", err)
+	}
+	if err := s.Free(); err != os.ErrClosed {
+		t.Fatalf("second Free: expected os.ErrClosed, got %v", err)
+	}
+}
+
+func testUseAfterFree(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	s := createStream(t, m)
+	if err := s.Free(); err != nil {
+		t.Fatalf("Free: %v", err)
+	}
+	checkClosed(t, "Free", s)
+}
+
+func testUseAfterFinish(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	s := createStream(t, m)
+	feed(t, s, Audio(m.SampleRate(), time.Second))
+	if _, err := s.FinishStream(); err != nil {
+		t.Fatalf("FinishStream: %v", err)
+	}
+	checkClosed(t, "FinishStream", s)
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close after FinishStream: %v", err)
+	}
+}
+
+func testFinishError(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+	failer, ok := m.(FinishFailer)
+	if !ok {
+		t.Skip("model cannot fail FinishStream")
+	}
+
+	s := createStream(t, m)
+	feed(t, s, Audio(m.SampleRate(), time.Second))
+	failer.FailNextFinish(model.ErrFailRunSess)
+	if _, err := s.FinishStream(); err != model.ErrFailRunSess {
+		t.Fatalf("FinishStream: expected ErrFailRunSess, got %v", err)
+	}
+	checkClosed(t, "failed FinishStream", s)
+	if n := m.Info().OpenStreams; n != 0 {
+		t.Errorf("Info.OpenStreams after a failed FinishStream: got %d", n)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close after a failed FinishStream: %v", err)
+	}
+}
+
+// checkClosed verifies every Stream method returns os.ErrClosed after call.
+func checkClosed(t *testing.T, call string, s model.Stream) {
+	t.Helper()
+	check := func(method string, err error) {
+		t.Helper()
+		if err != os.ErrClosed {
+			t.Errorf("%s after %s: expected os.ErrClosed, got %v", method, call, err)
+		}
+	}
+	check("Free", s.Free())
+	check("FeedAudioContent", s.FeedAudioContent(make([]int16, 320)))
+	_, err := s.IntermediateDecode()
+	check("IntermediateDecode", err)
+	_, err = s.IntermediateDecodeWithMetadata(NumResults)
+	check("IntermediateDecodeWithMetadata", err)
+	_, err = s.FinishStream()
+	check("FinishStream", err)
+	_, err = s.FinishStreamWithMetadata(NumResults)
+	check("FinishStreamWithMetadata", err)
+	_, err = s.FinishStreamWithBestHypothesis(NumResults)
+	check("FinishStreamWithBestHypothesis", err)
+	_, err = s.FinishStreamWithHypothesis(NumResults)
+	check("FinishStreamWithHypothesis", err)
+}
+
+func feed(t *testing.T, s model.Stream, audio []int16) {
+	t.Helper()
+	if err := s.FeedAudioContent(audio); err != nil {
+		t.Fatalf("FeedAudioContent: %v", err)
+	}
+}
+
+func testConcurrentCreateStream(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	const goroutines = 8
+	audio := Audio(m.SampleRate(), time.Millisecond*200)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines*2)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := m.CreateStream()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err = s.FeedAudioContent(audio); err != nil {
+				errs <- err
+			}
+			if _, err = s.FinishStreamWithMetadata(1); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent CreateStream: %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close after concurrent streams: %v", err)
+	}
+}
+
+func testMetadataShape(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	s := createStream(t, m)
+	feed(t, s, Audio(m.SampleRate(), time.Second))
+	mt, err := s.IntermediateDecodeWithMetadata(NumResults)
+	checkMetadata(t, "IntermediateDecodeWithMetadata", mt, err)
+	mt, err = s.FinishStreamWithMetadata(NumResults)
+	checkMetadata(t, "FinishStreamWithMetadata", mt, err)
+}
+
+func checkMetadata(t *testing.T, call string, mt *model.Metadata, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", call, err)
+	}
+	if mt == nil {
+		t.Fatalf("%s returned nil Metadata", call)
+	}
+	if len(mt.Transcripts) > NumResults {
+		t.Errorf("%s: %d transcripts exceed the %d requested", call, len(mt.Transcripts), NumResults)
+	}
+	for i, transcript := range mt.Transcripts {
+		if i > 0 && transcript.Confidence > mt.Transcripts[i-1].Confidence {
+			t.Errorf("%s: transcript %d is more confident than transcript %d", call, i, i-1)
+		}
+		for d, token := range transcript.Tokens {
+			if d == 0 {
+				continue
+			}
+			prev := transcript.Tokens[d-1]
+			if token.Timestep <= prev.Timestep {
+				t.Errorf("%s: transcript %d token %d timestep %d does not increase from %d", call, i, d, token.Timestep, prev.Timestep)
+			}
+			if token.StartTime < prev.StartTime {
+				t.Errorf("%s: transcript %d token %d start time %v precedes %v", call, i, d, token.StartTime, prev.StartTime)
+			}
+		}
+	}
+}
+
+func testHypothesisWords(t *testing.T, factory Factory) {
+	m := open(t, factory)
+	defer closeModel(t, m)
+
+	s := createStream(t, m)
+	feed(t, s, Audio(m.SampleRate(), time.Second))
+	hyp, err := s.FinishStreamWithHypothesis(NumResults)
+	if err != nil {
+		t.Fatalf("FinishStreamWithHypothesis: %v", err)
+	}
+	if len(hyp.Candidates) > NumResults {
+		t.Errorf("%d candidates exceed the %d requested", len(hyp.Candidates), NumResults)
+	}
+	for i, c := range hyp.Candidates {
+		words := strings.Fields(c.Text)
+		if len(words) != len(c.Words) {
+			t.Errorf("candidate %d: %d words for text %q, expected %d", i, len(c.Words), c.Text, len(words))
+			continue
+		}
+		for d, w := range c.Words {
+			if w.Value != words[d] {
+				t.Errorf("candidate %d word %d: expected %q, got %q", i, d, words[d], w.Value)
+			}
+			if w.EndTime < w.StartTime || w.Duration != w.EndTime-w.StartTime {
+				t.Errorf("candidate %d word %d: inconsistent timing %v-%v (%v)", i, d, w.StartTime, w.EndTime, w.Duration)
+			}
+			if d > 0 && w.StartTime < c.Words[d-1].EndTime {
+				t.Errorf("candidate %d word %d starts before the previous word ends", i, d)
+			}
+		}
+		if len(c.Words) > 0 && (c.StartTime != c.Words[0].StartTime || c.EndTime != c.Words[len(c.Words)-1].EndTime) {
+			t.Errorf("candidate %d: span %v-%v does not match its words", i, c.StartTime, c.EndTime)
+		}
+	}
+}
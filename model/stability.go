@@ -0,0 +1,177 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// StabilityConfig sets when a word of successive partial hypotheses is
+// committed. A word is committed once it and the words before it were
+// unchanged for MinRepeats partials and for MinAudio of audio.
+type StabilityConfig struct {
+	// MinRepeats defaults to 2.
+	MinRepeats int
+	// MinAudio of zero commits by repeat count alone.
+	MinAudio time.Duration
+}
+
+// StableText splits a hypothesis into the committed prefix, which later
+// hypotheses never change, and the volatile tail.
+type StableText struct {
+	Committed []Word
+	Volatile  []Word
+	// Newly are the words committed by the last update, the end of Committed.
+	Newly []Word
+}
+
+func (t StableText) CommittedText() string {
+	return joinWords(t.Committed)
+}
+
+func (t StableText) VolatileText() string {
+	return joinWords(t.Volatile)
+}
+
+// Text is the committed and the volatile text.
+func (t StableText) Text() string {
+	return joinWords(t.Committed, t.Volatile)
+}
+
+func joinWords(lists ...[]Word) string {
+	var b strings.Builder
+	for _, words := range lists {
+		for _, w := range words {
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(w.Value)
+		}
+	}
+	return b.String()
+}
+
+// candidateWord is a volatile word and how long it has been unchanged.
+type candidateWord struct {
+	value   string
+	repeats int
+	// since is the audio decoded when the word was first seen.
+	since time.Duration
+}
+
+// Stabilizer tracks word stability across the partial hypotheses of a stream.
+// A new hypothesis is aligned with the committed words by their longest common
+// prefix. Where it diverges, the words spelling the rest of the committed text,
+// e.g. "bc" for committed "b c", are skipped; otherwise the words starting
+// before the end of the last committed word are skipped, so a committed word is
+// never repeated or replaced. A Stabilizer is not safe for concurrent use.
+type Stabilizer struct {
+	config    StabilityConfig
+	committed []Word
+	tail      []candidateWord
+}
+
+func NewStabilizer(config StabilityConfig) *Stabilizer {
+	if config.MinRepeats <= 0 {
+		config.MinRepeats = 2
+	}
+	return &Stabilizer{config: config}
+}
+
+// Update records the partial hypothesis hyp, decoded after audio of the
+// stream, and commits the words that became stable.
+func (s *Stabilizer) Update(hyp HypothesisCandidate, audio time.Duration) StableText {
+	tail := s.volatile(hyp)
+
+	// Words after the first changed one are new.
+	changed := false
+	for i, w := range tail {
+		if !changed && i < len(s.tail) && s.tail[i].value == w.Value {
+			s.tail[i].repeats++
+			continue
+		}
+		changed = true
+		if i < len(s.tail) {
+			s.tail[i] = candidateWord{value: w.Value, repeats: 1, since: audio}
+		} else {
+			s.tail = append(s.tail, candidateWord{value: w.Value, repeats: 1, since: audio})
+		}
+	}
+	s.tail = s.tail[:len(tail)]
+
+	n := 0
+	for n < len(s.tail) && s.tail[n].repeats >= s.config.MinRepeats &&
+		audio-s.tail[n].since >= s.config.MinAudio {
+		n++
+	}
+	return s.commit(tail, n)
+}
+
+// Finish commits the final hypothesis hyp. The returned text is the committed
+// words followed by the words of hyp after them, which differs from hyp.Text
+// when hyp changed a committed word.
+func (s *Stabilizer) Finish(hyp HypothesisCandidate) StableText {
+	tail := s.volatile(hyp)
+	return s.commit(tail, len(tail))
+}
+
+// Committed returns the committed words.
+func (s *Stabilizer) Committed() []Word {
+	return s.committed
+}
+
+// volatile returns the words of hyp after the committed ones.
+func (s *Stabilizer) volatile(hyp HypothesisCandidate) []Word {
+	words := hyp.Words
+	k := 0
+	for k < len(words) && k < len(s.committed) && words[k].Value == s.committed[k].Value {
+		k++
+	}
+	if k == len(s.committed) {
+		return words[k:]
+	}
+
+	var rest, spelled strings.Builder
+	for _, w := range s.committed[k:] {
+		rest.WriteString(w.Value)
+	}
+	n := k
+	for n < len(words) && spelled.Len() < rest.Len() {
+		spelled.WriteString(words[n].Value)
+		n++
+	}
+	if spelled.String() == rest.String() {
+		return words[n:]
+	}
+
+	last := s.committed[len(s.committed)-1]
+	n = k
+	for n < len(words) && !after(words[n], last) {
+		n++
+	}
+	return words[n:]
+}
+
+// after reports whether w starts after the end of word, by timestep or, without
+// timesteps, by time.
+func after(w, word Word) bool {
+	if w.StartStep > 0 || word.EndStep > 0 {
+		return w.StartStep > word.EndStep
+	}
+	return w.StartTime > word.EndTime
+}
+
+// commit commits the first n words of tail.
+func (s *Stabilizer) commit(tail []Word, n int) StableText {
+	s.committed = append(s.committed, tail[:n]...)
+	if n < len(s.tail) {
+		s.tail = s.tail[:copy(s.tail, s.tail[n:])]
+	} else {
+		s.tail = s.tail[:0]
+	}
+	committed := s.committed[:len(s.committed):len(s.committed)]
+	return StableText{
+		Committed: committed,
+		Volatile:  tail[n:],
+		Newly:     committed[len(committed)-n:],
+	}
+}
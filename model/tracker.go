@@ -0,0 +1,214 @@
+package model
+
+import (
+	"context"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// TrackedStream is a stream added to a StreamTracker.
+type TrackedStream struct {
+	Info func() StreamInfo
+	// FreeInactive frees the stream unless it was already freed or had
+	// activity after cutoff, and returns its info.
+	FreeInactive func(cutoff time.Time) (StreamInfo, bool)
+}
+
+// never is a cutoff after any activity.
+var never = time.Unix(0, math.MaxInt64)
+
+// StreamTracker keeps the open streams of a Model implementation. It
+// implements Model.Streams, the idle reaper of Model.SetIdleTimeout, the leak
+// detector of Model.SetLeakDetector and the drain of Model.CloseContext. Its
+// lock is taken after the model's and never held while calling a
+// TrackedStream.
+type StreamTracker struct {
+	streams map[uint64]TrackedStream
+	closed  bool
+	// drained is created by Drain and closed once streams is empty.
+	drained    chan struct{}
+	stopReaper chan struct{}
+	leakReport func(Leak)
+	mu         sync.Mutex
+}
+
+// Add tracks the stream id. When the leak detector is set, the stream is freed
+// and reported once handle, the Stream returned to the caller, is garbage
+// collected. Add returns os.ErrClosed after Drain or Close.
+func (t *StreamTracker) Add(id uint64, handle interface{}, s TrackedStream) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed || t.drained != nil {
+		return os.ErrClosed
+	}
+	if t.streams == nil {
+		t.streams = make(map[uint64]TrackedStream)
+	}
+	t.streams[id] = s
+	if report := t.leakReport; report != nil {
+		stack := debug.Stack()
+		runtime.SetFinalizer(handle, func(interface{}) {
+			// Freeing may wait for the stream, so not on the finalizer goroutine.
+			go func() {
+				if info, ok := s.FreeInactive(never); ok {
+					report(Leak{StreamInfo: info, Stack: stack})
+				}
+			}()
+		})
+	}
+	return nil
+}
+
+// Remove forgets the stream id and reports whether it was tracked.
+func (t *StreamTracker) Remove(id uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.streams[id]; !ok {
+		return false
+	}
+	delete(t.streams, id)
+	t.checkDrained()
+	return true
+}
+
+// RemoveAll forgets every stream and returns how many there were.
+func (t *StreamTracker) RemoveAll() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(t.streams)
+	t.streams = nil
+	t.checkDrained()
+	return n
+}
+
+// checkDrained closes drained once the last stream is gone. t.mu must be held.
+func (t *StreamTracker) checkDrained() {
+	if t.drained != nil && len(t.streams) == 0 {
+		select {
+		case <-t.drained:
+		default:
+			close(t.drained)
+		}
+	}
+}
+
+// Len returns the number of open streams.
+func (t *StreamTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.streams)
+}
+
+// Draining reports whether Drain was called.
+func (t *StreamTracker) Draining() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.drained != nil
+}
+
+// Streams returns the info of the open streams, oldest first.
+func (t *StreamTracker) Streams() []StreamInfo {
+	streams := t.snapshot()
+	infos := make([]StreamInfo, 0, len(streams))
+	for _, s := range streams {
+		infos = append(infos, s.Info())
+	}
+	SortStreams(infos)
+	return infos
+}
+
+func (t *StreamTracker) snapshot() []TrackedStream {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	streams := make([]TrackedStream, 0, len(t.streams))
+	for _, s := range t.streams {
+		streams = append(streams, s)
+	}
+	return streams
+}
+
+// Drain stops accepting streams and waits until the open ones are removed.
+// When ctx is done first the remaining streams are freed and ctx.Err() is
+// returned. Calls in progress on a stream finish first.
+func (t *StreamTracker) Drain(ctx context.Context) error {
+	t.mu.Lock()
+	if t.drained == nil {
+		t.drained = make(chan struct{})
+		t.checkDrained()
+	}
+	drained := t.drained
+	t.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		for _, s := range t.snapshot() {
+			s.FreeInactive(never)
+		}
+		return ctx.Err()
+	}
+}
+
+// Close stops the idle reaper and accepting streams.
+func (t *StreamTracker) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	t.stopReaping()
+}
+
+// SetIdleTimeout starts freeing streams idle for timeout, replacing the
+// previous reaper. A timeout of zero stops it.
+func (t *StreamTracker) SetIdleTimeout(timeout time.Duration, report func(StreamInfo)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopReaping()
+	if timeout > 0 && !t.closed {
+		t.stopReaper = make(chan struct{})
+		go t.reap(timeout, report, t.stopReaper)
+	}
+}
+
+// stopReaping stops the idle reaper. t.mu must be held.
+func (t *StreamTracker) stopReaping() {
+	if t.stopReaper != nil {
+		close(t.stopReaper)
+		t.stopReaper = nil
+	}
+}
+
+// reap frees streams idle for timeout until stop is closed.
+func (t *StreamTracker) reap(timeout time.Duration, report func(StreamInfo), stop chan struct{}) {
+	interval := timeout / 4
+	if interval == 0 {
+		interval = timeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			cutoff := now.Add(-timeout)
+			for _, s := range t.snapshot() {
+				if info, ok := s.FreeInactive(cutoff); ok && report != nil {
+					report(info)
+				}
+			}
+		}
+	}
+}
+
+// SetLeakDetector reports the streams added afterwards that are garbage
+// collected while open. A nil report disables it.
+func (t *StreamTracker) SetLeakDetector(report func(Leak)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.leakReport = report
+}
@@ -0,0 +1,301 @@
+package deepspeech
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// ErrInvalidOption is returned by OpenContext for an out of range option.
+var ErrInvalidOption = errors.New("deepspeech: invalid option")
+
+// OpenError describes a model or scorer file that could not be opened.
+// Err is one of the model error codes, e.g. model.ErrNoModel.
+type OpenError struct {
+	Path string
+	Err  error
+	// Cause is the underlying file system error, if any.
+	Cause error
+}
+
+func (e *OpenError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("deepspeech: open %s: %v: %v", e.Path, e.Err, e.Cause)
+	}
+	return fmt.Sprintf("deepspeech: open %s: %v", e.Path, e.Err)
+}
+
+func (e *OpenError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether Cause matches target, so errors.Is(err, os.ErrNotExist)
+// holds for a missing file.
+func (e *OpenError) Is(target error) bool {
+	return e.Cause != nil && errors.Is(e.Cause, target)
+}
+
+// As finds the first error in the chain of Cause that matches target.
+func (e *OpenError) As(target interface{}) bool {
+	return e.Cause != nil && errors.As(e.Cause, target)
+}
+
+// Option configures OpenContext.
+type Option func(*openOptions)
+
+type openOptions struct {
+	backend   string
+	beamWidth uint32
+	alpha     float32
+	beta      float32
+	scorer    string
+	warmup    time.Duration
+
+	idleTimeout time.Duration
+	idleReport  func(model.StreamInfo)
+	leakReport  func(model.Leak)
+	admission   *model.Admission
+	feedQueue   *model.FeedQueue
+}
+
+// WithBackend selects a registered backend. Defaults to NativeBackend.
+func WithBackend(name string) Option {
+	return func(o *openOptions) {
+		o.backend = name
+	}
+}
+
+// WithBeamWidth sets the decoder beam width. Defaults to BeamWidth.
+func WithBeamWidth(beamWidth uint32) Option {
+	return func(o *openOptions) {
+		o.beamWidth = beamWidth
+	}
+}
+
+// WithAlphaBeta sets the scorer language model weight and word insertion
+// weight. Zero is a valid value. Defaults to LMAlpha and LMBeta.
+func WithAlphaBeta(alpha, beta float32) Option {
+	return func(o *openOptions) {
+		o.alpha = alpha
+		o.beta = beta
+	}
+}
+
+// WithScorer enables the external scorer at path.
+func WithScorer(path string) Option {
+	return func(o *openOptions) {
+		o.scorer = path
+	}
+}
+
+// WithWarmup decodes d of silence after opening so the memory mapped model is
+// paged in before the first real request.
+func WithWarmup(d time.Duration) Option {
+	return func(o *openOptions) {
+		o.warmup = d
+	}
+}
+
+// WithIdleTimeout frees streams left idle for timeout and reports them. See
+// model.Model.SetIdleTimeout.
+func WithIdleTimeout(timeout time.Duration, report func(model.StreamInfo)) Option {
+	return func(o *openOptions) {
+		o.idleTimeout = timeout
+		o.idleReport = report
+	}
+}
+
+// WithLeakDetector reports streams garbage collected while still open. See
+// model.Model.SetLeakDetector.
+func WithLeakDetector(report func(model.Leak)) Option {
+	return func(o *openOptions) {
+		o.leakReport = report
+	}
+}
+
+// WithMaxStreams limits the model to maxStreams open streams and SpeechToText
+// calls, with up to maxQueue callers waiting for a slot. See model.Admission.
+func WithMaxStreams(maxStreams, maxQueue int) Option {
+	return func(o *openOptions) {
+		o.admission = &model.Admission{MaxStreams: maxStreams, MaxQueue: maxQueue}
+	}
+}
+
+// WithFeedQueue sets the size and policy of the Stream.FeedAsync queue. See
+// model.FeedQueue.
+func WithFeedQueue(size int, policy model.QueuePolicy) Option {
+	return func(o *openOptions) {
+		o.feedQueue = &model.FeedQueue{Size: size, Policy: policy}
+	}
+}
+
+// OpenContext validates and opens the model at modelPath. Loading a large model
+// can take a while; if ctx is done first OpenContext returns ctx.Err() and the
+// model is closed in the background once it finishes loading.
+func OpenContext(ctx context.Context, modelPath string, opts ...Option) (model.Model, error) {
+	o := openOptions{
+		beamWidth: BeamWidth,
+		alpha:     LMAlpha,
+		beta:      LMBeta,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.beamWidth == 0 {
+		return nil, fmt.Errorf("%w: beam width must be positive", ErrInvalidOption)
+	}
+	if o.warmup < 0 {
+		return nil, fmt.Errorf("%w: negative warmup", ErrInvalidOption)
+	}
+	if o.idleTimeout < 0 {
+		return nil, fmt.Errorf("%w: negative idle timeout", ErrInvalidOption)
+	}
+	if o.admission != nil && (o.admission.MaxStreams < 0 || o.admission.MaxQueue < 0) {
+		return nil, fmt.Errorf("%w: negative stream limit", ErrInvalidOption)
+	}
+	if o.feedQueue != nil && (o.feedQueue.Size < 0 || o.feedQueue.Policy < model.QueueBlock || o.feedQueue.Policy > model.QueueError) {
+		return nil, fmt.Errorf("%w: invalid feed queue", ErrInvalidOption)
+	}
+	factory, err := backend(o.backend)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateModel(modelPath); err != nil {
+		return nil, err
+	}
+	if o.scorer != "" {
+		if err = validateScorer(o.scorer); err != nil {
+			return nil, err
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		m   model.Model
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		m, err := open(factory, modelPath, o)
+		done <- result{m, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.m, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.m != nil {
+				_ = r.m.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func open(factory BackendFactory, modelPath string, o openOptions) (model.Model, error) {
+	m, err := factory(modelPath, Config{
+		Backend:   o.backend,
+		BeamWidth: o.beamWidth,
+		LMAlpha:   o.alpha,
+		LMBeta:    o.beta,
+	})
+	if err != nil {
+		return nil, wrapOpenError(modelPath, err)
+	}
+	if o.scorer != "" {
+		if err = m.EnableExternalScorer(o.scorer, o.alpha, o.beta); err != nil {
+			_ = m.Close()
+			return nil, wrapOpenError(o.scorer, err)
+		}
+	}
+	if o.idleTimeout > 0 {
+		if err = m.SetIdleTimeout(o.idleTimeout, o.idleReport); err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+	}
+	if o.leakReport != nil {
+		if err = m.SetLeakDetector(o.leakReport); err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+	}
+	if o.admission != nil {
+		if err = m.SetAdmission(*o.admission); err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+	}
+	if o.feedQueue != nil {
+		if err = m.SetFeedQueue(*o.feedQueue); err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+	}
+	if o.warmup > 0 {
+		silence := make([]int16, int64(m.SampleRate())*int64(o.warmup)/int64(time.Second))
+		if _, err = m.SpeechToText(silence); err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func validateModel(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pbmm", ".tflite":
+	default:
+		return &OpenError{Path: path, Err: model.ErrModelIncompatible, Cause: errors.New("expected a .pbmm or .tflite file")}
+	}
+	if err := checkReadable(path); err != nil {
+		return &OpenError{Path: path, Err: model.ErrNoModel, Cause: err}
+	}
+	return nil
+}
+
+func validateScorer(path string) error {
+	if strings.ToLower(filepath.Ext(path)) != ".scorer" {
+		return &OpenError{Path: path, Err: model.ErrInvalidScorer, Cause: errors.New("expected a .scorer file")}
+	}
+	if err := checkReadable(path); err != nil {
+		return &OpenError{Path: path, Err: model.ErrScorerUnreadable, Cause: err}
+	}
+	return nil
+}
+
+func checkReadable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return errors.New("is a directory")
+	}
+	return nil
+}
+
+// wrapOpenError attaches path to engine error codes. Other errors, such as
+// load errors, are returned as is.
+func wrapOpenError(path string, err error) error {
+	var loadErr *LoadError
+	if errors.As(err, &loadErr) {
+		return err
+	}
+	return &OpenError{Path: path, Err: err}
+}
@@ -0,0 +1,192 @@
+package deepspeech
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/deepspeechtest"
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+const testBackend = "test"
+
+// testFactory is the factory of testBackend.
+var testFactory BackendFactory
+
+func init() {
+	RegisterBackend(testBackend, func(modelPath string, config Config) (model.Model, error) {
+		return testFactory(modelPath, config)
+	})
+}
+
+// testFiles creates an empty model and scorer file in a temporary directory.
+func testFiles(t *testing.T) (modelPath, scorerPath string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "deepspeech")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modelPath = filepath.Join(dir, "model.pbmm")
+	scorerPath = filepath.Join(dir, "model.scorer")
+	for _, path := range []string{modelPath, scorerPath} {
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return modelPath, scorerPath, func() { os.RemoveAll(dir) }
+}
+
+func TestValidateModel(t *testing.T) {
+	modelPath, scorerPath, cleanup := testFiles(t)
+	defer cleanup()
+	dir := filepath.Dir(modelPath)
+	if err := os.Mkdir(filepath.Join(dir, "dir.tflite"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		err  error
+	}{
+		{modelPath, nil},
+		{scorerPath, model.ErrModelIncompatible},
+		{filepath.Join(dir, "missing.pbmm"), model.ErrNoModel},
+		{filepath.Join(dir, "dir.tflite"), model.ErrNoModel},
+	}
+	for _, tt := range tests {
+		err := validateModel(tt.path)
+		if !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+			t.Errorf("validateModel(%s) = %v, want %v", filepath.Base(tt.path), err, tt.err)
+		}
+	}
+
+	err := validateModel(filepath.Join(dir, "missing.pbmm"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("validateModel of a missing file = %v, want os.ErrNotExist", err)
+	}
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) {
+		t.Errorf("validateModel of a missing file = %v, want an *os.PathError cause", err)
+	}
+}
+
+func TestValidateScorer(t *testing.T) {
+	modelPath, scorerPath, cleanup := testFiles(t)
+	defer cleanup()
+
+	tests := []struct {
+		path string
+		err  error
+	}{
+		{scorerPath, nil},
+		{modelPath, model.ErrInvalidScorer},
+		{filepath.Join(filepath.Dir(scorerPath), "missing.scorer"), model.ErrScorerUnreadable},
+	}
+	for _, tt := range tests {
+		err := validateScorer(tt.path)
+		if !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+			t.Errorf("validateScorer(%s) = %v, want %v", filepath.Base(tt.path), err, tt.err)
+		}
+	}
+	if err := validateScorer(tests[2].path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("validateScorer of a missing file = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestOpenContext_InvalidOption(t *testing.T) {
+	modelPath, _, cleanup := testFiles(t)
+	defer cleanup()
+	testFactory = func(string, Config) (model.Model, error) {
+		t.Error("backend called for an invalid option")
+		return nil, errors.New("unexpected open")
+	}
+
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"beam width", WithBeamWidth(0)},
+		{"warmup", WithWarmup(-time.Second)},
+		{"idle timeout", WithIdleTimeout(-time.Second, nil)},
+		{"max streams", WithMaxStreams(-1, 0)},
+		{"max queue", WithMaxStreams(1, -1)},
+		{"queue size", WithFeedQueue(-1, model.QueueBlock)},
+		{"queue policy", WithFeedQueue(1, model.QueueError+1)},
+	}
+	for _, tt := range tests {
+		_, err := OpenContext(context.Background(), modelPath, WithBackend(testBackend), tt.opt)
+		if !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("%s: err = %v, want ErrInvalidOption", tt.name, err)
+		}
+	}
+}
+
+func TestOpenContext(t *testing.T) {
+	modelPath, scorerPath, cleanup := testFiles(t)
+	defer cleanup()
+	fake := deepspeechtest.New(deepspeechtest.Config{})
+	testFactory = func(string, Config) (model.Model, error) {
+		return fake, nil
+	}
+
+	m, err := OpenContext(context.Background(), modelPath, WithBackend(testBackend),
+		WithScorer(scorerPath), WithAlphaBeta(0.5, 1.5), WithMaxStreams(2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if path, alpha, beta := fake.Scorer(); path != scorerPath || alpha != 0.5 || beta != 1.5 {
+		t.Errorf("scorer = %s %v %v", path, alpha, beta)
+	}
+	if stats := m.AdmissionStats(); stats.MaxStreams != 2 {
+		t.Errorf("MaxStreams = %d, want 2", stats.MaxStreams)
+	}
+}
+
+// closeSignal is a model that signals when it is closed.
+type closeSignal struct {
+	model.Model
+	closed chan struct{}
+}
+
+func (m closeSignal) Close() error {
+	close(m.closed)
+	return m.Model.Close()
+}
+
+func TestOpenContext_Cancel(t *testing.T) {
+	modelPath, _, cleanup := testFiles(t)
+	defer cleanup()
+	m := closeSignal{deepspeechtest.New(deepspeechtest.Config{}), make(chan struct{})}
+	started, release := make(chan struct{}), make(chan struct{})
+	testFactory = func(string, Config) (model.Model, error) {
+		close(started)
+		<-release
+		return m, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := OpenContext(ctx, modelPath, WithBackend(testBackend)); err != context.Canceled {
+		t.Fatalf("OpenContext with a done context = %v, want context.Canceled", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := OpenContext(ctx, modelPath, WithBackend(testBackend)); err != context.DeadlineExceeded {
+		t.Fatalf("OpenContext = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The model opened after the deadline is closed.
+	<-started
+	close(release)
+	select {
+	case <-m.closed:
+	case <-time.After(time.Second):
+		t.Fatal("model opened after cancellation was not closed")
+	}
+}
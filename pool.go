@@ -0,0 +1,429 @@
+package deepspeech
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// Pool spreads streams and SpeechToText calls over several model instances so
+// decoding is not serialized on a single ModelState. Instances share the memory
+// mapped model file, so each extra instance is cheap.
+//
+// Pool implements model.Model. Settings such as the scorer, beam width and hot
+// words are applied to every instance.
+type Pool struct {
+	models []model.Model
+	busy   []int
+	// shares are the stream limits of the instances set by SetAdmission, nil
+	// without a limit.
+	shares []int
+
+	closed bool
+	mu     sync.Mutex
+}
+
+// InstanceLoad is the load of a single Pool instance.
+type InstanceLoad struct {
+	Index       int
+	OpenStreams int
+	// Busy is the number of SpeechToText calls in progress.
+	Busy int
+}
+
+var _ model.Model = (*Pool)(nil)
+
+// ErrEmptyPool is returned by NewPool without models.
+var ErrEmptyPool = errors.New("deepspeech: pool needs at least one model")
+
+// OpenPool opens n instances of the model with OpenContext and pools them.
+func OpenPool(ctx context.Context, n int, modelPath string, opts ...Option) (*Pool, error) {
+	if n <= 0 {
+		return nil, ErrEmptyPool
+	}
+	models := make([]model.Model, 0, n)
+	for i := 0; i < n; i++ {
+		m, err := OpenContext(ctx, modelPath, opts...)
+		if err != nil {
+			for _, m := range models {
+				_ = m.Close()
+			}
+			return nil, err
+		}
+		models = append(models, m)
+	}
+	p, err := NewPool(models...)
+	if err != nil {
+		return nil, err
+	}
+	// WithMaxStreams limits the pool, not each instance.
+	var o openOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.admission != nil {
+		if err = p.SetAdmission(*o.admission); err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// NewPool pools already opened models. The models should be opened from the
+// same files with the same settings; the pool takes ownership of them.
+func NewPool(models ...model.Model) (*Pool, error) {
+	if len(models) == 0 {
+		return nil, ErrEmptyPool
+	}
+	return &Pool{
+		models: models,
+		busy:   make([]int, len(models)),
+	}, nil
+}
+
+// Size returns the number of instances.
+func (p *Pool) Size() int {
+	return len(p.models)
+}
+
+// Load returns the current load of every instance.
+func (p *Pool) Load() []InstanceLoad {
+	open := p.openStreams()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	load := make([]InstanceLoad, len(p.models))
+	for i := range p.models {
+		load[i] = InstanceLoad{
+			Index:       i,
+			OpenStreams: open[i],
+			Busy:        p.busy[i],
+		}
+	}
+	return load
+}
+
+// openStreams returns the open streams of every instance. It is called without
+// p.mu, so a slow instance does not hold up the others.
+func (p *Pool) openStreams() []int {
+	open := make([]int, len(p.models))
+	for i, m := range p.models {
+		open[i] = m.Info().OpenStreams
+	}
+	return open
+}
+
+// next returns the index of the least loaded instance given their open
+// streams, the one with the most free slots under a stream limit. It returns
+// model.ErrTooManyStreams if no instance has a share of the limit. p.mu must be
+// held.
+func (p *Pool) next(open []int) (int, error) {
+	best, bestLoad := -1, 0
+	for i := range p.models {
+		load := open[i] + p.busy[i]
+		if p.shares != nil {
+			if p.shares[i] == 0 {
+				continue
+			}
+			load -= p.shares[i]
+		}
+		if best < 0 || load < bestLoad {
+			best, bestLoad = i, load
+		}
+	}
+	if best < 0 {
+		return 0, model.ErrTooManyStreams
+	}
+	return best, nil
+}
+
+// acquire picks the instance for a stream or SpeechToText call and counts it
+// busy until release.
+func (p *Pool) acquire() (int, error) {
+	open := p.openStreams()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, os.ErrClosed
+	}
+	i, err := p.next(open)
+	if err != nil {
+		return 0, err
+	}
+	p.busy[i]++
+	return i, nil
+}
+
+func (p *Pool) release(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.busy[i]--
+}
+
+// each calls fn for every instance and returns the first error.
+func (p *Pool) each(fn func(m model.Model) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return os.ErrClosed
+	}
+	var first error
+	for _, m := range p.models {
+		if err := fn(m); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (p *Pool) EnableExternalScorer(path string, aAlpha, aBeta float32) error {
+	return p.each(func(m model.Model) error { return m.EnableExternalScorer(path, aAlpha, aBeta) })
+}
+
+func (p *Pool) DisableExternalScorer() error {
+	return p.each(func(m model.Model) error { return m.DisableExternalScorer() })
+}
+
+func (p *Pool) SetScorerAlphaBeta(aAlpha, aBeta float32) error {
+	return p.each(func(m model.Model) error { return m.SetScorerAlphaBeta(aAlpha, aBeta) })
+}
+
+func (p *Pool) ScorerEnabled() bool {
+	return p.models[0].ScorerEnabled()
+}
+
+func (p *Pool) AddHotWord(word string, boost float32) error {
+	return p.each(func(m model.Model) error { return m.AddHotWord(word, boost) })
+}
+
+func (p *Pool) EraseHotWord(word string) error {
+	return p.each(func(m model.Model) error { return m.EraseHotWord(word) })
+}
+
+func (p *Pool) ClearHotWords() error {
+	return p.each(func(m model.Model) error { return m.ClearHotWords() })
+}
+
+func (p *Pool) SampleRate() int {
+	return p.models[0].SampleRate()
+}
+
+func (p *Pool) BeamWidth() uint32 {
+	return p.models[0].BeamWidth()
+}
+
+func (p *Pool) SetBeamWidth(beamWidth uint32) error {
+	return p.each(func(m model.Model) error { return m.SetBeamWidth(beamWidth) })
+}
+
+func (p *Pool) SetIdleTimeout(timeout time.Duration, report func(model.StreamInfo)) error {
+	return p.each(func(m model.Model) error { return m.SetIdleTimeout(timeout, report) })
+}
+
+func (p *Pool) SetLeakDetector(report func(model.Leak)) error {
+	return p.each(func(m model.Model) error { return m.SetLeakDetector(report) })
+}
+
+// SetAdmission splits the limits over the instances, so the pool admits up to
+// limits.MaxStreams in total. With fewer streams than instances, the instances
+// left without a share are set to model.AdmitNone and not used.
+func (p *Pool) SetAdmission(limits model.Admission) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return os.ErrClosed
+	}
+	n := len(p.models)
+	if limits.MaxStreams > 0 && limits.MaxStreams < n {
+		n = limits.MaxStreams
+	}
+	var shares []int
+	if limits.MaxStreams != 0 {
+		shares = make([]int, len(p.models))
+	}
+	var first error
+	for i, m := range p.models {
+		share := model.Admission{
+			MaxStreams: split(limits.MaxStreams, n, i),
+			MaxQueue:   split(limits.MaxQueue, n, i),
+		}
+		if shares != nil {
+			if share.MaxStreams <= 0 {
+				share = model.Admission{MaxStreams: model.AdmitNone}
+			} else {
+				shares[i] = share.MaxStreams
+			}
+		}
+		if err := m.SetAdmission(share); err != nil && first == nil {
+			first = err
+		}
+	}
+	p.shares = shares
+	return first
+}
+
+// split returns the share of instance i when total is spread over the first n
+// instances.
+func split(total, n, i int) int {
+	if i >= n || total <= 0 {
+		return 0
+	}
+	share := total / n
+	if i < total%n {
+		share++
+	}
+	return share
+}
+
+// SetFeedQueue configures the FeedAsync queue of every instance.
+func (p *Pool) SetFeedQueue(queue model.FeedQueue) error {
+	return p.each(func(m model.Model) error { return m.SetFeedQueue(queue) })
+}
+
+// AdmissionStats sums the admission counters and limits of all instances.
+// Instances set to model.AdmitNone add no streams.
+func (p *Pool) AdmissionStats() model.AdmissionStats {
+	var stats model.AdmissionStats
+	none := 0
+	for _, m := range p.models {
+		s := m.AdmissionStats()
+		if s.MaxStreams == model.AdmitNone {
+			s.MaxStreams = 0
+			none++
+		}
+		stats = addStats(stats, s)
+	}
+	if none == len(p.models) {
+		stats.MaxStreams = model.AdmitNone
+	}
+	return stats
+}
+
+func addStats(a, b model.AdmissionStats) model.AdmissionStats {
+	a.MaxStreams += b.MaxStreams
+	a.MaxQueue += b.MaxQueue
+	a.Active += b.Active
+	a.Queued += b.Queued
+	a.Admitted += b.Admitted
+	a.Rejected += b.Rejected
+	a.Waited += b.Waited
+	a.WaitTime += b.WaitTime
+	return a
+}
+
+// Info returns the first instance's configuration with OpenStreams and the
+// decode totals summed over all instances.
+func (p *Pool) Info() model.Info {
+	info := p.models[0].Info()
+	for _, m := range p.models[1:] {
+		info = addInfo(info, m.Info())
+	}
+	return info
+}
+
+// addInfo adds the counters of b to a.
+func addInfo(a, b model.Info) model.Info {
+	a.OpenStreams += b.OpenStreams
+	a.AudioFed += b.AudioFed
+	a.DecodeTime += b.DecodeTime
+	return a
+}
+
+// Close closes every instance. It returns model.ErrOpenStreams without closing
+// any instance while streams are open.
+func (p *Pool) Close() error {
+	open := p.openStreams()
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return os.ErrClosed
+	}
+	for i := range p.models {
+		if open[i] > 0 || p.busy[i] > 0 {
+			p.mu.Unlock()
+			return model.ErrOpenStreams
+		}
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	var first error
+	for _, m := range p.models {
+		if err := m.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// CloseContext stops accepting new work and closes every instance with
+// CloseContext.
+func (p *Pool) CloseContext(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return os.ErrClosed
+	}
+	p.closed = true
+	p.mu.Unlock()
+	return closeAll(ctx, p.models)
+}
+
+// closeAll closes models concurrently with CloseContext and returns the first
+// error. Models that were already closed are skipped.
+func closeAll(ctx context.Context, models []model.Model) error {
+	errs := make([]error, len(models))
+	var wg sync.WaitGroup
+	for i, m := range models {
+		wg.Add(1)
+		go func(i int, m model.Model) {
+			defer wg.Done()
+			errs[i] = m.CloseContext(ctx)
+		}(i, m)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil && err != os.ErrClosed {
+			return err
+		}
+	}
+	return nil
+}
+
+// Streams lists the open streams of every instance, in instance order. Stream
+// IDs are only unique within an instance.
+func (p *Pool) Streams() []model.StreamInfo {
+	var streams []model.StreamInfo
+	for _, m := range p.models {
+		streams = append(streams, m.Streams()...)
+	}
+	return streams
+}
+
+func (p *Pool) SpeechToText(frame []int16) (string, error) {
+	i, err := p.acquire()
+	if err != nil {
+		return "", err
+	}
+	defer p.release(i)
+	return p.models[i].SpeechToText(frame)
+}
+
+func (p *Pool) CreateStream() (model.Stream, error) {
+	return p.CreateStreamContext(context.Background())
+}
+
+// CreateStreamContext creates the stream on the least loaded instance,
+// waiting in that instance's queue if its stream limit is reached.
+func (p *Pool) CreateStreamContext(ctx context.Context) (model.Stream, error) {
+	i, err := p.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer p.release(i)
+	return p.models[i].CreateStreamContext(ctx)
+}
@@ -0,0 +1,182 @@
+package deepspeech
+
+import (
+	"testing"
+
+	"github.com/mologix-co/deepspeech-go/deepspeechtest"
+	"github.com/mologix-co/deepspeech-go/model"
+	"github.com/mologix-co/deepspeech-go/model/modeltest"
+)
+
+func newTestPool(t *testing.T, n int) *Pool {
+	models := make([]model.Model, n)
+	for i := range models {
+		m := deepspeechtest.New(deepspeechtest.Config{}).Default(deepspeechtest.Candidate{Text: "hello world"})
+		if err := m.EnableExternalScorer("test.scorer", model.LMAlpha, model.LMBeta); err != nil {
+			t.Fatal(err)
+		}
+		models[i] = m
+	}
+	p, err := NewPool(models...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPool_Conformance(t *testing.T) {
+	modeltest.Run(t, func(t *testing.T) model.Model {
+		return newTestPool(t, 3)
+	})
+}
+
+func TestPool_LeastOpenStreams(t *testing.T) {
+	p := newTestPool(t, 3)
+	streams := make([]model.Stream, 6)
+	for i := range streams {
+		s, err := p.CreateStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		streams[i] = s
+	}
+	for _, load := range p.Load() {
+		if load.OpenStreams != 2 {
+			t.Fatalf("expected 2 streams on every instance, got %+v", p.Load())
+		}
+	}
+	for _, s := range streams {
+		_ = s.Free()
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPool_Admission(t *testing.T) {
+	p := newTestPool(t, 3)
+	for _, limit := range []int{2, 4} {
+		if err := p.SetAdmission(model.Admission{MaxStreams: limit}); err != nil {
+			t.Fatal(err)
+		}
+		var streams []model.Stream
+		for i := 0; i < limit; i++ {
+			s, err := p.CreateStream()
+			if err != nil {
+				t.Fatalf("limit %d: stream %d: %v", limit, i, err)
+			}
+			streams = append(streams, s)
+		}
+		if _, err := p.CreateStream(); err != model.ErrTooManyStreams {
+			t.Fatalf("limit %d: expected ErrTooManyStreams, got %v", limit, err)
+		}
+		if stats := p.AdmissionStats(); stats.MaxStreams != limit || stats.Active != limit {
+			t.Fatalf("limit %d: unexpected stats %+v", limit, stats)
+		}
+		for _, s := range streams {
+			_ = s.Free()
+		}
+	}
+
+	// Instances without a share admit nothing, even when reached directly.
+	if err := p.SetAdmission(model.Admission{MaxStreams: 2, MaxQueue: 3}); err != nil {
+		t.Fatal(err)
+	}
+	want := []model.Admission{{MaxStreams: 1, MaxQueue: 2}, {MaxStreams: 1, MaxQueue: 1}, {MaxStreams: model.AdmitNone}}
+	for i, m := range p.models {
+		if got := m.AdmissionStats().Admission; got != want[i] {
+			t.Errorf("instance %d: admission %+v, want %+v", i, got, want[i])
+		}
+	}
+	if _, err := p.models[2].CreateStream(); err != model.ErrTooManyStreams {
+		t.Fatalf("instance without a share: expected ErrTooManyStreams, got %v", err)
+	}
+	if stats := p.AdmissionStats(); stats.MaxStreams != 2 || stats.MaxQueue != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// MaxQueue is split over all instances with a larger limit.
+	if err := p.SetAdmission(model.Admission{MaxStreams: 4, MaxQueue: 5}); err != nil {
+		t.Fatal(err)
+	}
+	for i, queue := range []int{2, 2, 1} {
+		if got := p.models[i].AdmissionStats().MaxQueue; got != queue {
+			t.Errorf("instance %d: MaxQueue %d, want %d", i, got, queue)
+		}
+	}
+	if stats := p.AdmissionStats(); stats.MaxStreams != 4 || stats.MaxQueue != 5 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	if err := p.SetAdmission(model.Admission{MaxStreams: model.AdmitNone}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.CreateStream(); err != model.ErrTooManyStreams {
+		t.Fatalf("AdmitNone: expected ErrTooManyStreams, got %v", err)
+	}
+	if stats := p.AdmissionStats(); stats.MaxStreams != model.AdmitNone {
+		t.Fatalf("AdmitNone: unexpected stats %+v", stats)
+	}
+
+	if err := p.SetAdmission(model.Admission{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		if _, err := p.CreateStream(); err != nil {
+			t.Fatalf("stream %d without a limit: %v", i, err)
+		}
+	}
+}
+
+// slowInfo is a model whose Info signals called and waits for release.
+type slowInfo struct {
+	model.Model
+	called, release chan struct{}
+}
+
+func (m slowInfo) Info() model.Info {
+	select {
+	case m.called <- struct{}{}:
+	default:
+	}
+	<-m.release
+	return m.Model.Info()
+}
+
+func TestPool_SlowInstance(t *testing.T) {
+	slow := slowInfo{deepspeechtest.New(deepspeechtest.Config{}), make(chan struct{}, 1), make(chan struct{})}
+	p, err := NewPool(deepspeechtest.New(deepspeechtest.Config{}), slow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := make(chan []InstanceLoad)
+	go func() { loaded <- p.Load() }()
+	<-slow.called
+
+	// The pool is not locked while an instance is slow.
+	if err = p.SetBeamWidth(100); err != nil {
+		t.Fatal(err)
+	}
+	close(slow.release)
+	if load := <-loaded; len(load) != 2 {
+		t.Fatalf("Load = %+v", load)
+	}
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPool_NoShare(t *testing.T) {
+	p := newTestPool(t, 2)
+	p.shares = []int{0, 0}
+	if _, err := p.CreateStream(); err != model.ErrTooManyStreams {
+		t.Fatalf("CreateStream without shares = %v, want ErrTooManyStreams", err)
+	}
+	if _, err := p.SpeechToText(make([]int16, 160)); err != model.ErrTooManyStreams {
+		t.Fatalf("SpeechToText without shares = %v, want ErrTooManyStreams", err)
+	}
+	p.shares = nil
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
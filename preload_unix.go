@@ -0,0 +1,27 @@
+// +build linux darwin
+// +build !deepspeech_cgo
+
+package deepspeech
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <stdlib.h>
+#include <dlfcn.h>
+*/
+import "C"
+import (
+	"errors"
+	"unsafe"
+)
+
+// preload opens the shared library at path with global symbol visibility so
+// the plugin resolves libdeepspeech against it instead of searching the
+// linker path. The handle is never closed.
+func preload(path string) error {
+	cstrPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cstrPath))
+	if C.dlopen(cstrPath, C.RTLD_NOW|C.RTLD_GLOBAL) == nil {
+		return errors.New(C.GoString(C.dlerror()))
+	}
+	return nil
+}
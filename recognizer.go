@@ -0,0 +1,261 @@
+package deepspeech
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// EventType is the kind of a recognizer Event.
+type EventType int
+
+const (
+	// Partial is an intermediate transcript whose text or committed words
+	// changed since the last one.
+	Partial EventType = iota + 1
+	// Final is the transcript of the finished stream.
+	Final
+	// Error reports a failed feed or decode. Final or Error is the last event.
+	Error
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Partial:
+		return "partial"
+	case Final:
+		return "final"
+	case Error:
+		return "error"
+	}
+	return "unknown"
+}
+
+// Event is a result of a Recognizer.
+type Event struct {
+	Type EventType
+	// Text is Stable.Text() of a Partial or Final event. It differs from the
+	// decoded text when the decoder changed a committed word.
+	Text string
+	// Hypothesis is the best candidate of a Final event, nil if the decoder
+	// returned none.
+	Hypothesis *model.HypothesisCandidate
+	// Stable splits the words of a Partial or Final event into the committed
+	// prefix, never retracted by later events, and the volatile tail. All
+	// words of a Final event are committed.
+	Stable model.StableText
+	Err    error
+	// Audio is the audio fed when the event was produced.
+	Audio time.Duration
+	// Segment is the index of the ContinuousStream segment, zero for a
+	// Recognizer.
+	Segment int
+}
+
+// RecognizerConfig configures a Recognizer. Zero values are replaced by their
+// defaults.
+type RecognizerConfig struct {
+	// SampleRate of the fed audio. Defaults to 16000, the rate of the
+	// DeepSpeech models.
+	SampleRate int
+	// PartialInterval is the wall time between partial decodes and
+	// PartialAudio the audio fed between them; a partial is decoded once
+	// either has passed. PartialAudio defaults to 200ms, a PartialInterval of
+	// zero only decodes by audio.
+	PartialInterval time.Duration
+	PartialAudio    time.Duration
+	// Candidates is the number of candidates decoded for the Final event.
+	// Defaults to 1.
+	Candidates uint32
+	// Stability sets when words of the partials are committed.
+	Stability model.StabilityConfig
+	// Async feeds with Stream.FeedAsync, so Feed does not wait for inference
+	// between partial decodes.
+	Async bool
+
+	// OnEvent, if not nil, is called with every event on the goroutine calling
+	// the Recognizer, instead of sending it to Events. It must not call the
+	// Recognizer.
+	OnEvent func(Event)
+	// Buffer is the capacity of the Events channel. Defaults to 16.
+	Buffer int
+}
+
+// Recognizer feeds a stream, decodes partial results as audio arrives and
+// emits them as events, skipping partials that did not change.
+type Recognizer struct {
+	stream     model.Stream
+	config     RecognizerConfig
+	events     chan Event
+	stabilizer *model.Stabilizer
+
+	// samples is the audio fed. partialSamples and partialAt are the audio
+	// and time of the last partial decode, and partialStep the samples
+	// between partial decodes.
+	samples        int64
+	partialSamples int64
+	partialAt      time.Time
+	partialStep    int64
+	lastPartial    string
+	done           bool
+	mu             sync.Mutex
+}
+
+// NewRecognizer returns a Recognizer for s. The Recognizer owns s: it is
+// finished by Finish and freed by Close.
+func NewRecognizer(s model.Stream, config RecognizerConfig) *Recognizer {
+	config.defaults()
+	r := &Recognizer{
+		stream:      s,
+		config:      config,
+		partialAt:   time.Now(),
+		partialStep: int64(config.SampleRate) * int64(config.PartialAudio) / int64(time.Second),
+		stabilizer:  model.NewStabilizer(config.Stability),
+	}
+	if config.OnEvent == nil {
+		r.events = make(chan Event, config.Buffer)
+	}
+	return r
+}
+
+func (c *RecognizerConfig) defaults() {
+	if c.SampleRate <= 0 {
+		c.SampleRate = 16000
+	}
+	if c.PartialAudio <= 0 {
+		c.PartialAudio = 200 * time.Millisecond
+	}
+	if c.Candidates == 0 {
+		c.Candidates = 1
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = 16
+	}
+}
+
+// Events returns the channel receiving the events, closed after the last one.
+// It is nil when RecognizerConfig.OnEvent is set. Feed and Finish block while
+// the channel is full.
+func (r *Recognizer) Events() <-chan Event {
+	return r.events
+}
+
+// Feed feeds frame and emits a Partial event when a partial decode is due and
+// its text changed.
+func (r *Recognizer) Feed(frame []int16) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return os.ErrClosed
+	}
+	var err error
+	if r.config.Async {
+		err = r.stream.FeedAsync(frame)
+	} else {
+		err = r.stream.FeedAudioContent(frame)
+	}
+	if err != nil {
+		return r.fail(err)
+	}
+	r.samples += int64(len(frame))
+
+	if !r.partialDue(time.Now()) {
+		return nil
+	}
+	mt, err := r.stream.IntermediateDecodeWithMetadata(1)
+	if err != nil {
+		return r.fail(err)
+	}
+	r.partialSamples = r.samples
+	r.partialAt = time.Now()
+	var hyp model.HypothesisCandidate
+	if candidates := model.NewHypothesis(mt).Candidates; len(candidates) > 0 {
+		hyp = candidates[0]
+	}
+	stable := r.stabilizer.Update(hyp, r.audio())
+	if text := stable.Text(); text != r.lastPartial || len(stable.Newly) > 0 {
+		r.lastPartial = text
+		r.emit(Event{Type: Partial, Text: text, Stable: stable, Audio: r.audio()})
+	}
+	return nil
+}
+
+// partialDue reports whether a partial decode is due at now. r.mu must be
+// held.
+func (r *Recognizer) partialDue(now time.Time) bool {
+	if r.samples-r.partialSamples >= r.partialStep {
+		return true
+	}
+	return r.config.PartialInterval > 0 && r.samples > r.partialSamples &&
+		now.Sub(r.partialAt) >= r.config.PartialInterval
+}
+
+// Finish finishes the stream and emits the Final event.
+func (r *Recognizer) Finish() (Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return Event{}, os.ErrClosed
+	}
+	hyp, err := r.stream.FinishStreamWithBestHypothesis(r.config.Candidates)
+	if err != nil {
+		return Event{}, r.fail(err)
+	}
+	e := Event{Type: Final, Hypothesis: hyp, Audio: r.audio()}
+	if hyp != nil {
+		e.Stable = r.stabilizer.Finish(*hyp)
+	} else {
+		e.Stable = r.stabilizer.Finish(model.HypothesisCandidate{})
+	}
+	e.Text = e.Stable.Text()
+	r.emit(e)
+	r.end()
+	return e, nil
+}
+
+// Close frees the stream unless it was finished and closes Events.
+func (r *Recognizer) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return nil
+	}
+	r.end()
+	if err := r.stream.Free(); err != nil && err != os.ErrClosed {
+		return err
+	}
+	return nil
+}
+
+// fail emits an Error event, frees the stream and returns err. r.mu must be
+// held.
+func (r *Recognizer) fail(err error) error {
+	r.emit(Event{Type: Error, Err: err, Audio: r.audio()})
+	r.end()
+	_ = r.stream.Free()
+	return err
+}
+
+// emit delivers e. r.mu must be held.
+func (r *Recognizer) emit(e Event) {
+	if r.config.OnEvent != nil {
+		r.config.OnEvent(e)
+		return
+	}
+	r.events <- e
+}
+
+// end marks the recognizer done after its last event. r.mu must be held.
+func (r *Recognizer) end() {
+	r.done = true
+	if r.events != nil {
+		close(r.events)
+	}
+}
+
+// audio returns the duration of the audio fed. r.mu must be held.
+func (r *Recognizer) audio() time.Duration {
+	return time.Duration(r.samples) * time.Second / time.Duration(r.config.SampleRate)
+}
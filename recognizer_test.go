@@ -0,0 +1,203 @@
+package deepspeech
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/deepspeechtest"
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+func TestRecognizer_Events(t *testing.T) {
+	m := deepspeechtest.New(deepspeechtest.Config{}).Transcribe(func(audio []int16) []deepspeechtest.Candidate {
+		if len(audio) < 6400 {
+			return []deepspeechtest.Candidate{{Text: "hello"}}
+		}
+		return []deepspeechtest.Candidate{{Text: "hello world"}}
+	})
+	s, err := m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRecognizer(s, RecognizerConfig{Buffer: 8})
+	for i := 0; i < 50; i++ {
+		if err = r.Feed(make([]int16, 320)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	final, err := r.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final.Type != Final || final.Text != "hello world" || final.Audio != time.Second {
+		t.Fatalf("unexpected final %+v", final)
+	}
+
+	var events []Event
+	for e := range r.Events() {
+		events = append(events, e)
+	}
+	want := []Event{
+		{Type: Partial, Text: "hello", Audio: 200 * time.Millisecond},
+		{Type: Partial, Text: "hello world", Audio: 400 * time.Millisecond},
+		// Unchanged, but "world" was committed.
+		{Type: Partial, Text: "hello world", Audio: 600 * time.Millisecond},
+		final,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i := range want {
+		if events[i].Type != want[i].Type || events[i].Text != want[i].Text || events[i].Audio != want[i].Audio {
+			t.Fatalf("event %d: expected %+v, got %+v", i, want[i], events[i])
+		}
+	}
+	if err = r.Feed(make([]int16, 320)); err == nil {
+		t.Fatal("expected Feed after Finish to fail")
+	}
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecognizer_Stability(t *testing.T) {
+	m := deepspeechtest.New(deepspeechtest.Config{}).Transcribe(func(audio []int16) []deepspeechtest.Candidate {
+		switch {
+		case len(audio) < 6400:
+			return []deepspeechtest.Candidate{{Text: "the cat"}}
+		case len(audio) < 9600:
+			return []deepspeechtest.Candidate{{Text: "the cap sat"}}
+		case len(audio) < 12800:
+			return []deepspeechtest.Candidate{{Text: "the cap sat on"}}
+		}
+		return []deepspeechtest.Candidate{{Text: "the cap sat on it"}}
+	})
+	s, err := m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []Event
+	r := NewRecognizer(s, RecognizerConfig{
+		Stability: model.StabilityConfig{MinRepeats: 2},
+		OnEvent:   func(e Event) { events = append(events, e) },
+	})
+	for i := 0; i < 50; i++ {
+		if err = r.Feed(make([]int16, 320)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = r.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][2]string{
+		{"", "the cat"},
+		{"the", "cap sat"},
+		{"the cap sat", "on"},
+		{"the cap sat on", "it"},
+		{"the cap sat on it", ""},
+		{"the cap sat on it", ""},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, e := range events {
+		if got := [2]string{e.Stable.CommittedText(), e.Stable.VolatileText()}; got != want[i] {
+			t.Fatalf("event %d: expected %q, got %q", i, want[i], got)
+		}
+	}
+
+	// MinAudio holds back words seen for less audio.
+	st := model.NewStabilizer(model.StabilityConfig{MinRepeats: 1, MinAudio: time.Second})
+	hyp := model.HypothesisCandidate{Words: []model.Word{{Value: "hello"}}}
+	if text := st.Update(hyp, time.Second); len(text.Committed) != 0 {
+		t.Fatalf("expected nothing committed, got %+v", text)
+	}
+	if text := st.Update(hyp, 2*time.Second); text.CommittedText() != "hello" {
+		t.Fatalf("expected hello committed, got %+v", text)
+	}
+
+	// Hypotheses are aligned with the committed words, not by position.
+	st = model.NewStabilizer(model.StabilityConfig{MinRepeats: 1})
+	st.Update(words("a b c"), 0)
+	if text := st.Update(words("a bc d"), 0); text.CommittedText() != "a b c d" {
+		t.Fatalf("expected the joined word skipped, got %+v", text)
+	}
+	if text := st.Update(words("a x y"), 0); text.CommittedText() != "a b c d" || text.VolatileText() != "" {
+		t.Fatalf("expected words over committed audio skipped, got %+v", text)
+	}
+	if text := st.Finish(words("a x y z e")); text.Text() != "a b c d e" || text.CommittedText() != text.Text() {
+		t.Fatalf("expected the words after the committed ones committed by Finish, got %+v", text)
+	}
+}
+
+// words is a hypothesis of the words of text, timed by their offset in text.
+func words(text string) model.HypothesisCandidate {
+	var hyp model.HypothesisCandidate
+	offset := 0
+	for _, w := range strings.Fields(text) {
+		offset += strings.Index(text[offset:], w)
+		hyp.Words = append(hyp.Words, model.Word{Value: w, StartStep: offset, EndStep: offset + len(w)})
+		offset += len(w)
+	}
+	return hyp
+}
+
+func TestRecognizer_FinalKeepsCommitted(t *testing.T) {
+	m := deepspeechtest.New(deepspeechtest.Config{}).Transcribe(func(audio []int16) []deepspeechtest.Candidate {
+		if len(audio) < 9600 {
+			return []deepspeechtest.Candidate{{Text: "the cat"}}
+		}
+		return []deepspeechtest.Candidate{{Text: "the cap sat"}}
+	})
+	s, err := m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRecognizer(s, RecognizerConfig{Stability: model.StabilityConfig{MinRepeats: 2}})
+	for i := 0; i < 50; i++ {
+		if err = r.Feed(make([]int16, 320)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	final, err := r.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final.Hypothesis == nil || final.Hypothesis.Text != "the cap sat" {
+		t.Fatalf("unexpected final hypothesis %+v", final.Hypothesis)
+	}
+	if final.Text != "the cat sat" || final.Stable.Text() != final.Text || final.Stable.CommittedText() != final.Text {
+		t.Fatalf("expected the committed words kept, got %q, %+v", final.Text, final.Stable)
+	}
+	for e := range r.Events() {
+		if e.Text != e.Stable.Text() {
+			t.Fatalf("%s event text %q, stable %q", e.Type, e.Text, e.Stable.Text())
+		}
+	}
+}
+
+func TestRecognizer_Error(t *testing.T) {
+	m := deepspeechtest.New(deepspeechtest.Config{}).FailNext(deepspeechtest.OpIntermediateDecode, model.ErrFailRunSess)
+	s, err := m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []Event
+	r := NewRecognizer(s, RecognizerConfig{
+		PartialAudio: 20 * time.Millisecond,
+		Async:        true,
+		OnEvent:      func(e Event) { events = append(events, e) },
+	})
+	if err = r.Feed(make([]int16, 320)); err != model.ErrFailRunSess {
+		t.Fatalf("expected ErrFailRunSess, got %v", err)
+	}
+	if len(events) != 1 || events[0].Type != Error || events[0].Err != model.ErrFailRunSess {
+		t.Fatalf("expected one Error event, got %+v", events)
+	}
+	// The stream was freed.
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,639 @@
+package deepspeech
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// Opener opens a fresh model instance for Reloadable.
+type Opener func(ctx context.Context) (model.Model, error)
+
+// Reloadable is a model.Model whose model and scorer can be reloaded without
+// dropping streams. After a reload new streams go to the freshly loaded model
+// while existing streams finish on the old one, which is closed once its last
+// stream is done.
+//
+// Scorer, beam width, hot word, idle timeout, leak detector, admission and
+// feed queue changes made through the Reloadable are applied again to every
+// reloaded model.
+type Reloadable struct {
+	open  Opener
+	paths []string
+
+	current  *generation
+	draining map[*generation]struct{}
+	closed   bool
+
+	// Settings changed at runtime, replayed after a reload. They are guarded
+	// by settings, which serializes setting changes and reloads so neither
+	// calls a model with mu held.
+	scorer      *scorerSettings
+	beamWidth   uint32
+	hotWords    map[string]float32
+	idleTimeout time.Duration
+	idleReport  func(model.StreamInfo)
+	leakReport  func(model.Leak)
+	admission   *model.Admission
+	feedQueue   *model.FeedQueue
+
+	settings sync.Mutex
+	mu       sync.Mutex
+}
+
+type scorerSettings struct {
+	enabled bool
+	path    string
+	alpha   float32
+	beta    float32
+	// weightsOnly is set when only SetScorerAlphaBeta was called.
+	weightsOnly bool
+}
+
+// generation is one loaded model and the number of calls in progress on it.
+// Its streams are counted by the model itself, so streams freed by the idle
+// reaper or the leak detector are accounted for.
+type generation struct {
+	m       model.Model
+	calls   int
+	retired bool
+}
+
+// idle reports whether g has no calls in progress and no open streams. r.mu
+// must be held.
+func (g *generation) idle() bool {
+	return g.calls == 0 && g.m.Info().OpenStreams == 0
+}
+
+var _ model.Model = (*Reloadable)(nil)
+
+// OpenReloadable opens the model with OpenContext. Reload and Watch open the
+// same files again with the same options.
+func OpenReloadable(ctx context.Context, modelPath string, opts ...Option) (*Reloadable, error) {
+	var o openOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	paths := []string{modelPath}
+	if o.scorer != "" {
+		paths = append(paths, o.scorer)
+	}
+	return NewReloadable(ctx, func(ctx context.Context) (model.Model, error) {
+		return OpenContext(ctx, modelPath, opts...)
+	}, paths...)
+}
+
+// NewReloadable opens the first model with open. paths are the files Watch
+// polls for changes.
+func NewReloadable(ctx context.Context, open Opener, paths ...string) (*Reloadable, error) {
+	m, err := open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Reloadable{
+		open:     open,
+		paths:    paths,
+		current:  &generation{m: m},
+		draining: make(map[*generation]struct{}),
+		hotWords: make(map[string]float32),
+	}, nil
+}
+
+// Reload opens a new model and switches new streams to it. The previous model
+// is closed once its open streams are finished. On error the current model is
+// kept.
+func (r *Reloadable) Reload(ctx context.Context) error {
+	m, err := r.open(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.settings.Lock()
+	defer r.settings.Unlock()
+	if err = r.apply(m); err != nil {
+		_ = m.Close()
+		return err
+	}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		_ = m.Close()
+		return os.ErrClosed
+	}
+	old := r.current
+	r.current = &generation{m: m}
+	old.retired = true
+	idle := old.idle()
+	if !idle {
+		r.draining[old] = struct{}{}
+	}
+	r.mu.Unlock()
+
+	if idle {
+		return old.m.Close()
+	}
+	return nil
+}
+
+// apply replays the runtime settings on m. r.settings must be held.
+func (r *Reloadable) apply(m model.Model) error {
+	if r.scorer != nil {
+		var err error
+		switch {
+		case r.scorer.weightsOnly:
+			err = m.SetScorerAlphaBeta(r.scorer.alpha, r.scorer.beta)
+		case r.scorer.enabled:
+			if info := m.Info(); info.ScorerEnabled && info.ScorerPath == r.scorer.path {
+				// Already loaded by the opener.
+				err = m.SetScorerAlphaBeta(r.scorer.alpha, r.scorer.beta)
+			} else {
+				err = m.EnableExternalScorer(r.scorer.path, r.scorer.alpha, r.scorer.beta)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if r.beamWidth != 0 {
+		if err := m.SetBeamWidth(r.beamWidth); err != nil {
+			return err
+		}
+	}
+	if len(r.hotWords) > 0 {
+		// Hot words need a scorer and are kept once it is disabled, so a
+		// disabled scorer is enabled with its last path to add them.
+		if !m.ScorerEnabled() && r.scorer != nil && r.scorer.path != "" {
+			if err := m.EnableExternalScorer(r.scorer.path, r.scorer.alpha, r.scorer.beta); err != nil {
+				return err
+			}
+		}
+		for word, boost := range r.hotWords {
+			if err := m.AddHotWord(word, boost); err != nil {
+				return err
+			}
+		}
+	}
+	if r.scorer != nil && !r.scorer.enabled && !r.scorer.weightsOnly && m.ScorerEnabled() {
+		if err := m.DisableExternalScorer(); err != nil {
+			return err
+		}
+	}
+	if r.idleTimeout != 0 {
+		if err := m.SetIdleTimeout(r.idleTimeout, r.onIdle(r.idleReport)); err != nil {
+			return err
+		}
+	}
+	if r.leakReport != nil {
+		if err := m.SetLeakDetector(r.onLeak(r.leakReport)); err != nil {
+			return err
+		}
+	}
+	if r.admission != nil {
+		if err := m.SetAdmission(*r.admission); err != nil {
+			return err
+		}
+	}
+	if r.feedQueue != nil {
+		if err := m.SetFeedQueue(*r.feedQueue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultWatchInterval is the Watch interval used when it is not positive.
+const DefaultWatchInterval = time.Second
+
+// Watch polls the model and scorer files every interval and reloads once a
+// change has been stable for one interval, so partially copied files are not
+// loaded. A scorer enabled through the Reloadable is watched as well. report,
+// if not nil, is called with the result of every reload. Watch returns when
+// ctx is done.
+func (r *Reloadable) Watch(ctx context.Context, interval time.Duration, report func(error)) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	last := r.stat()
+	var pending []fileStat
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := r.stat()
+		switch {
+		case !samePaths(current, last):
+			// The scorer was switched; its file is new to the watch.
+			pending = nil
+			last = current
+		case pending != nil && sameStats(current, pending):
+			pending = nil
+			last = current
+			err := r.Reload(ctx)
+			if report != nil {
+				report(err)
+			}
+		case !sameStats(current, last):
+			pending = current
+		default:
+			pending = nil
+		}
+	}
+}
+
+type fileStat struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// stat returns the stats of the watched paths and of a scorer enabled at
+// runtime.
+func (r *Reloadable) stat() []fileStat {
+	paths := r.paths
+	r.settings.Lock()
+	if r.scorer != nil && r.scorer.enabled && !containsString(paths, r.scorer.path) {
+		paths = append(paths[:len(paths):len(paths)], r.scorer.path)
+	}
+	r.settings.Unlock()
+
+	stats := make([]fileStat, len(paths))
+	for i, path := range paths {
+		stats[i].path = path
+		if info, err := os.Stat(path); err == nil {
+			stats[i].size, stats[i].modTime = info.Size(), info.ModTime()
+		}
+	}
+	return stats
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func samePaths(a, b []fileStat) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].path != b[i].path {
+			return false
+		}
+	}
+	return true
+}
+
+func sameStats(a, b []fileStat) bool {
+	for i := range a {
+		if a[i].size != b[i].size || !a[i].modTime.Equal(b[i].modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// acquire returns the current generation with a call in progress.
+func (r *Reloadable) acquire() (*generation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, os.ErrClosed
+	}
+	r.current.calls++
+	return r.current, nil
+}
+
+// release ends a call on g and closes retired generations that became idle.
+func (r *Reloadable) release(g *generation) {
+	r.mu.Lock()
+	g.calls--
+	r.mu.Unlock()
+	r.sweep()
+}
+
+// sweep closes the retired generations without calls or streams.
+func (r *Reloadable) sweep() {
+	var idle []*generation
+	r.mu.Lock()
+	for g := range r.draining {
+		if g.idle() {
+			delete(r.draining, g)
+			idle = append(idle, g)
+		}
+	}
+	r.mu.Unlock()
+	for _, g := range idle {
+		_ = g.m.Close()
+	}
+}
+
+// onIdle wraps an idle stream report so a generation drained by the reaper is
+// closed.
+func (r *Reloadable) onIdle(report func(model.StreamInfo)) func(model.StreamInfo) {
+	return func(info model.StreamInfo) {
+		if report != nil {
+			report(info)
+		}
+		r.sweep()
+	}
+}
+
+func (r *Reloadable) onLeak(report func(model.Leak)) func(model.Leak) {
+	return func(leak model.Leak) {
+		report(leak)
+		r.sweep()
+	}
+}
+
+func (r *Reloadable) currentModel() model.Model {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current.m
+}
+
+// update applies fn to the current model and records the setting on success.
+func (r *Reloadable) update(fn func(m model.Model) error, record func()) error {
+	r.settings.Lock()
+	defer r.settings.Unlock()
+	r.mu.Lock()
+	closed, m := r.closed, r.current.m
+	r.mu.Unlock()
+	if closed {
+		return os.ErrClosed
+	}
+	if err := fn(m); err != nil {
+		return err
+	}
+	record()
+	return nil
+}
+
+func (r *Reloadable) EnableExternalScorer(path string, aAlpha, aBeta float32) error {
+	return r.update(func(m model.Model) error {
+		return m.EnableExternalScorer(path, aAlpha, aBeta)
+	}, func() {
+		r.scorer = &scorerSettings{enabled: true, path: path, alpha: aAlpha, beta: aBeta}
+	})
+}
+
+func (r *Reloadable) DisableExternalScorer() error {
+	var info model.Info
+	return r.update(func(m model.Model) error {
+		info = m.Info()
+		return m.DisableExternalScorer()
+	}, func() {
+		// The path is kept to replay the hot words.
+		r.scorer = &scorerSettings{path: info.ScorerPath, alpha: info.Alpha, beta: info.Beta}
+	})
+}
+
+func (r *Reloadable) SetScorerAlphaBeta(aAlpha, aBeta float32) error {
+	return r.update(func(m model.Model) error {
+		return m.SetScorerAlphaBeta(aAlpha, aBeta)
+	}, func() {
+		if r.scorer == nil || r.scorer.weightsOnly {
+			r.scorer = &scorerSettings{weightsOnly: true}
+		}
+		r.scorer.alpha = aAlpha
+		r.scorer.beta = aBeta
+	})
+}
+
+func (r *Reloadable) ScorerEnabled() bool {
+	return r.currentModel().ScorerEnabled()
+}
+
+func (r *Reloadable) AddHotWord(word string, boost float32) error {
+	return r.update(func(m model.Model) error {
+		return m.AddHotWord(word, boost)
+	}, func() {
+		r.hotWords[word] = boost
+	})
+}
+
+func (r *Reloadable) EraseHotWord(word string) error {
+	return r.update(func(m model.Model) error {
+		return m.EraseHotWord(word)
+	}, func() {
+		delete(r.hotWords, word)
+	})
+}
+
+func (r *Reloadable) ClearHotWords() error {
+	return r.update(func(m model.Model) error {
+		return m.ClearHotWords()
+	}, func() {
+		r.hotWords = make(map[string]float32)
+	})
+}
+
+func (r *Reloadable) SampleRate() int {
+	return r.currentModel().SampleRate()
+}
+
+func (r *Reloadable) BeamWidth() uint32 {
+	return r.currentModel().BeamWidth()
+}
+
+func (r *Reloadable) SetBeamWidth(beamWidth uint32) error {
+	return r.update(func(m model.Model) error {
+		return m.SetBeamWidth(beamWidth)
+	}, func() {
+		r.beamWidth = beamWidth
+	})
+}
+
+func (r *Reloadable) SetIdleTimeout(timeout time.Duration, report func(model.StreamInfo)) error {
+	return r.update(func(m model.Model) error {
+		return m.SetIdleTimeout(timeout, r.onIdle(report))
+	}, func() {
+		r.idleTimeout = timeout
+		r.idleReport = report
+	})
+}
+
+func (r *Reloadable) SetLeakDetector(report func(model.Leak)) error {
+	return r.update(func(m model.Model) error {
+		if report == nil {
+			return m.SetLeakDetector(nil)
+		}
+		return m.SetLeakDetector(r.onLeak(report))
+	}, func() {
+		r.leakReport = report
+	})
+}
+
+func (r *Reloadable) SetAdmission(limits model.Admission) error {
+	return r.update(func(m model.Model) error {
+		return m.SetAdmission(limits)
+	}, func() {
+		r.admission = &limits
+	})
+}
+
+func (r *Reloadable) SetFeedQueue(queue model.FeedQueue) error {
+	return r.update(func(m model.Model) error {
+		return m.SetFeedQueue(queue)
+	}, func() {
+		r.feedQueue = &queue
+	})
+}
+
+// AdmissionStats returns the current model's counters. Active includes the
+// slots still used on models replaced by a reload.
+func (r *Reloadable) AdmissionStats() model.AdmissionStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.current.m.AdmissionStats()
+	for g := range r.draining {
+		stats.Active += g.m.AdmissionStats().Active
+	}
+	return stats
+}
+
+// Info describes the current model. OpenStreams and the decode totals include
+// models replaced by a reload that are still finishing streams.
+func (r *Reloadable) Info() model.Info {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info := r.current.m.Info()
+	for g := range r.draining {
+		info = addInfo(info, g.m.Info())
+	}
+	return info
+}
+
+// Draining returns the number of replaced models still finishing streams.
+func (r *Reloadable) Draining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.draining)
+}
+
+// Close closes the current model. It returns model.ErrOpenStreams while
+// streams are open on any model.
+func (r *Reloadable) Close() error {
+	r.sweep()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	if !r.current.idle() || len(r.draining) > 0 {
+		return model.ErrOpenStreams
+	}
+	if err := r.current.m.Close(); err != nil {
+		return err
+	}
+	r.closed = true
+	return nil
+}
+
+// CloseContext stops accepting new work and closes the current model and the
+// models still draining after a reload with CloseContext.
+func (r *Reloadable) CloseContext(ctx context.Context) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return os.ErrClosed
+	}
+	r.closed = true
+	models := []model.Model{r.current.m}
+	for g := range r.draining {
+		models = append(models, g.m)
+	}
+	r.mu.Unlock()
+
+	// A draining model may be closed by its last stream meanwhile, which
+	// closeAll ignores.
+	return closeAll(ctx, models)
+}
+
+// Streams lists the open streams of the current and draining models. Stream
+// IDs are only unique within a model.
+func (r *Reloadable) Streams() []model.StreamInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	streams := r.current.m.Streams()
+	for g := range r.draining {
+		streams = append(streams, g.m.Streams()...)
+	}
+	return streams
+}
+
+func (r *Reloadable) SpeechToText(frame []int16) (string, error) {
+	g, err := r.acquire()
+	if err != nil {
+		return "", err
+	}
+	defer r.release(g)
+	return g.m.SpeechToText(frame)
+}
+
+func (r *Reloadable) CreateStream() (model.Stream, error) {
+	return r.CreateStreamContext(context.Background())
+}
+
+func (r *Reloadable) CreateStreamContext(ctx context.Context) (model.Stream, error) {
+	g, err := r.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer r.release(g)
+	s, err := g.m.CreateStreamContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &reloadStream{Stream: s, r: r}, nil
+}
+
+// reloadStream closes its generation, if retired, once finished or freed.
+type reloadStream struct {
+	model.Stream
+	r    *Reloadable
+	once sync.Once
+}
+
+func (s *reloadStream) done() {
+	s.once.Do(s.r.sweep)
+}
+
+func (s *reloadStream) Free() error {
+	err := s.Stream.Free()
+	if err == nil || err == os.ErrClosed {
+		s.done()
+	}
+	return err
+}
+
+func (s *reloadStream) FinishStream() (string, error) {
+	defer s.done()
+	return s.Stream.FinishStream()
+}
+
+func (s *reloadStream) FinishStreamWithMetadata(aNumResults uint32) (*model.Metadata, error) {
+	defer s.done()
+	return s.Stream.FinishStreamWithMetadata(aNumResults)
+}
+
+func (s *reloadStream) FinishStreamWithBestHypothesis(aNumResults uint32) (*model.HypothesisCandidate, error) {
+	defer s.done()
+	return s.Stream.FinishStreamWithBestHypothesis(aNumResults)
+}
+
+func (s *reloadStream) FinishStreamWithHypothesis(aNumResults uint32) (model.Hypothesis, error) {
+	defer s.done()
+	return s.Stream.FinishStreamWithHypothesis(aNumResults)
+}
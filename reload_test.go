@@ -0,0 +1,193 @@
+package deepspeech
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/deepspeechtest"
+	"github.com/mologix-co/deepspeech-go/model"
+	"github.com/mologix-co/deepspeech-go/model/modeltest"
+)
+
+func newTestReloadable(t *testing.T, opened *[]*deepspeechtest.Model) *Reloadable {
+	r, err := NewReloadable(context.Background(), func(ctx context.Context) (model.Model, error) {
+		m := deepspeechtest.New(deepspeechtest.Config{}).Default(deepspeechtest.Candidate{Text: "hello world"})
+		if err := m.EnableExternalScorer("test.scorer", model.LMAlpha, model.LMBeta); err != nil {
+			return nil, err
+		}
+		if opened != nil {
+			*opened = append(*opened, m)
+		}
+		return m, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestReloadable_Conformance(t *testing.T) {
+	modeltest.Run(t, func(t *testing.T) model.Model {
+		return newTestReloadable(t, nil)
+	})
+}
+
+func TestReloadable_Reload(t *testing.T) {
+	var opened []*deepspeechtest.Model
+	r := newTestReloadable(t, &opened)
+	if err := r.AddHotWord("hello", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DisableExternalScorer(); err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := r.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(opened) != 2 || opened[1].HotWords()["hello"] != 5 {
+		t.Fatal("hot words were not applied to the reloaded model")
+	}
+	if opened[1].ScorerEnabled() {
+		t.Fatal("scorer was not disabled on the reloaded model")
+	}
+
+	s, err := r.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened[0].OpenStreams() != 1 || opened[1].OpenStreams() != 1 {
+		t.Fatal("new stream was not created on the reloaded model")
+	}
+	if r.Draining() != 1 {
+		t.Fatalf("expected 1 draining model, got %d", r.Draining())
+	}
+
+	if _, err = old.FinishStream(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Draining() != 0 {
+		t.Fatal("old model still draining after its last stream finished")
+	}
+	if _, err = opened[0].CreateStream(); err != os.ErrClosed {
+		t.Fatalf("old model was not closed: %v", err)
+	}
+
+	_ = s.Free()
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadable_WatchInterval(t *testing.T) {
+	r := newTestReloadable(t, nil)
+	defer r.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Watch(ctx, 0, nil)
+	}()
+	cancel()
+	<-done
+}
+
+func TestReloadable_ScorerLoadedOnce(t *testing.T) {
+	var opened []*deepspeechtest.Model
+	r, err := NewReloadable(context.Background(), func(ctx context.Context) (model.Model, error) {
+		m := deepspeechtest.New(deepspeechtest.Config{})
+		if err := m.EnableExternalScorer("test.scorer", model.LMAlpha, model.LMBeta); err != nil {
+			return nil, err
+		}
+		if len(opened) > 0 {
+			m.FailNext(deepspeechtest.OpEnableExternalScorer, errors.New("scorer loaded twice"))
+		}
+		opened = append(opened, m)
+		return m, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err = r.EnableExternalScorer("test.scorer", 0.5, 1.5); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if path, alpha, beta := opened[1].Scorer(); path != "test.scorer" || alpha != 0.5 || beta != 1.5 {
+		t.Fatalf("reloaded scorer = %s %v %v", path, alpha, beta)
+	}
+}
+
+func TestReloadable_Watch(t *testing.T) {
+	modelPath, scorerPath, cleanup := testFiles(t)
+	defer cleanup()
+	var opened []*deepspeechtest.Model
+	r, err := NewReloadable(context.Background(), func(ctx context.Context) (model.Model, error) {
+		m := deepspeechtest.New(deepspeechtest.Config{})
+		opened = append(opened, m)
+		return m, nil
+	}, modelPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	reloaded := make(chan error, 1)
+	go func() {
+		defer close(done)
+		r.Watch(ctx, 10*time.Millisecond, func(err error) { reloaded <- err })
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	touch := func(path string) {
+		t.Helper()
+		modTime := time.Now().Add(time.Hour)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-reloaded:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no reload after %s changed", filepath.Base(path))
+		}
+	}
+	// Watch takes its first stats when it starts.
+	time.Sleep(50 * time.Millisecond)
+	touch(modelPath)
+
+	// A scorer enabled at runtime is watched too.
+	if err = r.EnableExternalScorer(scorerPath, model.LMAlpha, model.LMBeta); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	touch(scorerPath)
+	if len(opened) != 3 {
+		t.Fatalf("expected 2 reloads, got %d", len(opened)-1)
+	}
+	if path, _, _ := opened[2].Scorer(); path != scorerPath {
+		t.Fatalf("reloaded scorer = %q, want %q", path, scorerPath)
+	}
+	select {
+	case err := <-reloaded:
+		t.Fatalf("unexpected reload: %v", err)
+	default:
+	}
+}
@@ -0,0 +1,615 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// Model is a model.Model served by a worker process.
+type Model struct {
+	config Config
+	// ctx is cancelled by Close to stop restarts.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// worker is nil while restarting; ready is closed once it is set.
+	worker *worker
+	ready  chan struct{}
+	info   model.Info
+
+	// Settings replayed on a restarted worker. They are written with settings
+	// and mu held.
+	beamWidth     uint32
+	scorerEnabled bool
+	scorerPath    string
+	alpha         float32
+	beta          float32
+	hotWords      map[string]float32
+
+	closed bool
+	// draining is set by CloseContext. calls counts the CreateStream and
+	// SpeechToText calls in progress, which it waits for.
+	draining bool
+	calls    sync.WaitGroup
+	counter  uint64
+	streams  model.StreamTracker
+
+	gate      model.Gate
+	feedQueue model.FeedQueue
+
+	samplesFed int64
+	decodeTime time.Duration
+
+	// settings serializes setting changes, restarts and closing, so no call
+	// to the worker is made with mu held.
+	settings sync.Mutex
+	mu       sync.Mutex
+}
+
+var _ model.Model = (*Model)(nil)
+
+func newModel(config Config, w *worker) *Model {
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan struct{})
+	close(ready)
+	m := &Model{
+		config:        config,
+		ctx:           ctx,
+		cancel:        cancel,
+		worker:        w,
+		ready:         ready,
+		info:          w.info,
+		beamWidth:     w.info.BeamWidth,
+		scorerEnabled: w.info.ScorerEnabled,
+		scorerPath:    w.info.ScorerPath,
+		alpha:         w.info.Alpha,
+		beta:          w.info.Beta,
+		hotWords:      make(map[string]float32),
+	}
+	go m.supervise(w)
+	return m
+}
+
+// supervise restarts the worker once w dies, unless the model was closed.
+func (m *Model) supervise(w *worker) {
+	<-w.dead
+	err := w.failed()
+	if err == os.ErrClosed {
+		// Closed by Close.
+		return
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.detach(w)
+	m.mu.Unlock()
+	m.report(err)
+
+	delay := m.config.RestartDelay
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if err = m.restart(); err == nil {
+			return
+		}
+		m.report(err)
+		if delay *= 2; delay > m.config.MaxRestartDelay {
+			delay = m.config.MaxRestartDelay
+		}
+	}
+}
+
+// detach forgets the dead worker w and its streams. m.mu must be held.
+func (m *Model) detach(w *worker) {
+	if m.worker != w {
+		return
+	}
+	m.worker = nil
+	m.ready = make(chan struct{})
+	// Streams are only added while their worker is current, so all of them
+	// are on w.
+	for n := m.streams.RemoveAll(); n > 0; n-- {
+		m.gate.Release()
+	}
+}
+
+// restart starts a new worker and applies the settings.
+func (m *Model) restart() error {
+	w, err := startWorker(m.ctx, m.config)
+	if err != nil {
+		return err
+	}
+	m.settings.Lock()
+	defer m.settings.Unlock()
+	m.mu.Lock()
+	closed := m.closed
+	m.mu.Unlock()
+	if closed {
+		w.kill(m.config.CloseTimeout)
+		return nil
+	}
+	if err = m.apply(w); err != nil {
+		w.kill(m.config.CloseTimeout)
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.worker = w
+	m.info = w.info
+	close(m.ready)
+	go m.supervise(w)
+	return nil
+}
+
+// apply replays the settings on w. m.settings must be held.
+func (m *Model) apply(w *worker) error {
+	if m.beamWidth != w.info.BeamWidth {
+		var e encoder
+		e.u32(m.beamWidth)
+		if _, err := w.call(opSetBeamWidth, e.buf); err != nil {
+			return err
+		}
+	}
+	// Hot words need a scorer and are kept once it is disabled, so a
+	// disabled scorer is enabled with its last path to add them.
+	enabled := w.info.ScorerEnabled
+	if m.scorerEnabled || len(m.hotWords) > 0 && m.scorerPath != "" {
+		var e encoder
+		e.str(m.scorerPath)
+		e.f32(m.alpha)
+		e.f32(m.beta)
+		if _, err := w.call(opEnableScorer, e.buf); err != nil {
+			return err
+		}
+		enabled = true
+	}
+	for word, boost := range m.hotWords {
+		var e encoder
+		e.str(word)
+		e.f32(boost)
+		if _, err := w.call(opAddHotWord, e.buf); err != nil {
+			return err
+		}
+	}
+	if enabled && !m.scorerEnabled {
+		if _, err := w.call(opDisableScorer, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Model) report(err error) {
+	if m.config.Report != nil {
+		m.config.Report(err)
+	}
+}
+
+// current returns the running worker, waiting for a restart until ctx is done.
+func (m *Model) current(ctx context.Context) (*worker, error) {
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return nil, os.ErrClosed
+		}
+		if w := m.worker; w != nil {
+			if w.failed() == nil {
+				m.mu.Unlock()
+				return w, nil
+			}
+			// The worker died; supervise restarts it.
+			m.detach(w)
+		}
+		ready := m.ready
+		m.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-m.ctx.Done():
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// update sends a settings request and records the setting on success. It
+// holds m.settings so settings are not changed during a restart.
+func (m *Model) update(op op, payload []byte, record func()) error {
+	for {
+		w, err := m.current(context.Background())
+		if err != nil {
+			return err
+		}
+		m.settings.Lock()
+		m.mu.Lock()
+		closed, current := m.closed, m.worker == w
+		m.mu.Unlock()
+		if closed {
+			m.settings.Unlock()
+			return os.ErrClosed
+		}
+		if !current {
+			// Restarted meanwhile.
+			m.settings.Unlock()
+			continue
+		}
+		if _, err = w.call(op, payload); err == nil {
+			m.mu.Lock()
+			record()
+			m.mu.Unlock()
+		}
+		m.settings.Unlock()
+		return err
+	}
+}
+
+func (m *Model) EnableExternalScorer(path string, aAlpha, aBeta float32) error {
+	var e encoder
+	e.str(path)
+	e.f32(aAlpha)
+	e.f32(aBeta)
+	return m.update(opEnableScorer, e.buf, func() {
+		m.scorerEnabled = true
+		m.scorerPath = path
+		m.alpha, m.beta = aAlpha, aBeta
+	})
+}
+
+func (m *Model) DisableExternalScorer() error {
+	// scorerPath is kept to replay the hot words.
+	return m.update(opDisableScorer, nil, func() {
+		m.scorerEnabled = false
+	})
+}
+
+func (m *Model) SetScorerAlphaBeta(aAlpha, aBeta float32) error {
+	var e encoder
+	e.f32(aAlpha)
+	e.f32(aBeta)
+	return m.update(opSetAlphaBeta, e.buf, func() {
+		m.alpha, m.beta = aAlpha, aBeta
+	})
+}
+
+func (m *Model) ScorerEnabled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.scorerEnabled
+}
+
+func (m *Model) AddHotWord(word string, boost float32) error {
+	var e encoder
+	e.str(word)
+	e.f32(boost)
+	return m.update(opAddHotWord, e.buf, func() {
+		m.hotWords[word] = boost
+	})
+}
+
+func (m *Model) EraseHotWord(word string) error {
+	var e encoder
+	e.str(word)
+	return m.update(opEraseHotWord, e.buf, func() {
+		delete(m.hotWords, word)
+	})
+}
+
+func (m *Model) ClearHotWords() error {
+	return m.update(opClearHotWords, nil, func() {
+		m.hotWords = make(map[string]float32)
+	})
+}
+
+func (m *Model) SampleRate() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.info.SampleRate
+}
+
+func (m *Model) BeamWidth() uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.beamWidth
+}
+
+func (m *Model) SetBeamWidth(beamWidth uint32) error {
+	var e encoder
+	e.u32(beamWidth)
+	return m.update(opSetBeamWidth, e.buf, func() {
+		m.beamWidth = beamWidth
+	})
+}
+
+// Info describes the worker's model without calling the worker: the model
+// fields come from the worker's hello and the settings from those made through
+// Model. OpenStreams and the decode totals are counted by Model, so they include
+// streams lost in a crash.
+func (m *Model) Info() model.Info {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	info := m.info
+	info.BeamWidth = m.beamWidth
+	info.ScorerEnabled = m.scorerEnabled
+	info.ScorerPath = m.scorerPath
+	info.Alpha = m.alpha
+	info.Beta = m.beta
+	info.OpenStreams = m.streams.Len()
+	info.AudioFed = m.fed(m.samplesFed)
+	info.DecodeTime = m.decodeTime
+	return info
+}
+
+// fed converts samples to audio duration. m.mu must be held.
+func (m *Model) fed(samples int64) time.Duration {
+	if m.info.SampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(samples) * time.Second / time.Duration(m.info.SampleRate)
+}
+
+// Close closes the model and stops the worker. It returns
+// model.ErrOpenStreams while streams are open.
+func (m *Model) Close() error {
+	m.settings.Lock()
+	defer m.settings.Unlock()
+	m.mu.Lock()
+	closed, open := m.closed, m.streams.Len()
+	m.mu.Unlock()
+	if closed {
+		return os.ErrClosed
+	}
+	if open > 0 {
+		return model.ErrOpenStreams
+	}
+	return m.shutdown(false)
+}
+
+// shutdown stops the worker and closes the model. When the worker refuses to
+// close, e.g. with open streams, it is killed if force is set and the model
+// stays open otherwise. m.settings must be held.
+func (m *Model) shutdown(force bool) error {
+	m.mu.Lock()
+	w := m.worker
+	m.mu.Unlock()
+	var err error
+	if w != nil {
+		if err = w.close(m.config.CloseTimeout); err != nil {
+			if !force {
+				return err
+			}
+			w.kill(m.config.CloseTimeout)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	m.cancel()
+	m.streams.Close()
+	m.gate.Close()
+	return err
+}
+
+func (m *Model) CloseContext(ctx context.Context) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return os.ErrClosed
+	}
+	m.draining = true
+	m.gate.Close()
+	m.mu.Unlock()
+
+	// Streams being created are tracked or freed once their call returns.
+	calls := make(chan struct{})
+	go func() {
+		m.calls.Wait()
+		close(calls)
+	}()
+	select {
+	case <-calls:
+	case <-ctx.Done():
+	}
+	err := m.streams.Drain(ctx)
+
+	m.settings.Lock()
+	defer m.settings.Unlock()
+	m.mu.Lock()
+	closed := m.closed
+	m.mu.Unlock()
+	if closed {
+		return os.ErrClosed
+	}
+	if cerr := m.shutdown(true); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (m *Model) Streams() []model.StreamInfo {
+	return m.streams.Streams()
+}
+
+func (m *Model) SetIdleTimeout(timeout time.Duration, report func(model.StreamInfo)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	m.streams.SetIdleTimeout(timeout, report)
+	return nil
+}
+
+func (m *Model) SetLeakDetector(report func(model.Leak)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	m.streams.SetLeakDetector(report)
+	return nil
+}
+
+func (m *Model) SetAdmission(limits model.Admission) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	m.gate.Set(limits)
+	return nil
+}
+
+func (m *Model) SetFeedQueue(queue model.FeedQueue) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return os.ErrClosed
+	}
+	m.feedQueue = queue
+	return nil
+}
+
+func (m *Model) AdmissionStats() model.AdmissionStats {
+	return m.gate.Stats()
+}
+
+// begin acquires an admission slot for a call that CloseContext waits for.
+func (m *Model) begin(ctx context.Context) error {
+	if err := m.gate.Acquire(ctx); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed || m.draining {
+		m.gate.Release()
+		return os.ErrClosed
+	}
+	m.calls.Add(1)
+	return nil
+}
+
+// SpeechToText returns ErrTooLarge for more than MaxSamples samples.
+func (m *Model) SpeechToText(frame []int16) (string, error) {
+	if len(frame) > MaxSamples {
+		return "", ErrTooLarge
+	}
+	if err := m.begin(context.Background()); err != nil {
+		return "", err
+	}
+	defer m.calls.Done()
+	defer m.gate.Release()
+	w, err := m.current(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	var e encoder
+	e.samples(frame)
+	start := time.Now()
+	d, err := w.call(opSpeechToText, e.buf)
+	m.measure(len(frame), time.Since(start))
+	if err != nil {
+		return "", err
+	}
+	text := d.str()
+	return text, d.err
+}
+
+// measure adds n samples and the decode time d to the totals.
+func (m *Model) measure(n int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samplesFed += int64(n)
+	m.decodeTime += d
+}
+
+func (m *Model) CreateStream() (model.Stream, error) {
+	return m.CreateStreamContext(context.Background())
+}
+
+func (m *Model) CreateStreamContext(ctx context.Context) (model.Stream, error) {
+	if err := m.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer m.calls.Done()
+	w, err := m.current(ctx)
+	if err != nil {
+		m.gate.Release()
+		return nil, err
+	}
+	d, err := w.call(opCreateStream, nil)
+	var remote uint64
+	if err == nil {
+		remote = d.u64()
+		err = d.err
+	}
+	if err != nil {
+		m.gate.Release()
+		return nil, err
+	}
+
+	m.mu.Lock()
+	h, err := m.addStream(w, remote)
+	m.mu.Unlock()
+	if err != nil {
+		// Freed before the slot is released, so a closing worker has no
+		// streams left.
+		var e encoder
+		e.u64(remote)
+		w.call(opFree, e.buf)
+		m.gate.Release()
+		return nil, err
+	}
+	return h, nil
+}
+
+// addStream tracks the stream remote created on w. m.mu must be held.
+func (m *Model) addStream(w *worker, remote uint64) (*handle, error) {
+	if m.worker != w && !m.closed {
+		return nil, w.failed()
+	}
+	if m.closed {
+		return nil, os.ErrClosed
+	}
+	m.counter++
+	s := &stream{
+		model:   m,
+		w:       w,
+		id:      m.counter,
+		remote:  remote,
+		created: time.Now(),
+	}
+	s.queue = model.NewAsyncFeeder(m.feedQueue, s.feed)
+	s.touch(0)
+	h := &handle{s}
+	if err := m.streams.Add(s.id, h, s.tracked()); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// removeStream forgets s and frees its admission slot. It is a no-op for a
+// stream already removed, e.g. after a crash.
+func (m *Model) removeStream(s *stream) {
+	if m.streams.Remove(s.id) {
+		m.gate.Release()
+	}
+}
+
+// handle is the Stream returned by CreateStream. The model only references
+// the embedded stream, so the leak detector's finalizer on the handle runs
+// once the caller drops it.
+type handle struct {
+	*stream
+}
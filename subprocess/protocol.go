@@ -0,0 +1,345 @@
+package subprocess
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// A frame is a little-endian uint32 length followed by that many bytes: the op,
+// the call id and the op's payload. Replies carry the id of their request.
+//
+//	length uint32 | op uint8 | id uint64 | payload
+const (
+	headerSize = 1 + 8
+	// maxFrame bounds frames read, so a corrupt length cannot exhaust memory.
+	maxFrame = 64 << 20
+)
+
+// MaxSamples is the most audio a single SpeechToText call can send to the
+// worker, about 35 minutes at 16kHz. Longer audio fails with ErrTooLarge and
+// should be fed to a stream instead, which splits it into smaller frames.
+const MaxSamples = (maxFrame - headerSize - 8 - 4) / 2
+
+// ErrTooLarge is returned for a call whose payload does not fit in a frame,
+// such as SpeechToText with more than MaxSamples samples. The call is not sent
+// and the worker keeps running.
+var ErrTooLarge = errors.New("deepspeech: subprocess call too large")
+
+type op uint8
+
+const (
+	// opHello is sent by the worker once its model is open, with the model
+	// Info as payload.
+	opHello op = iota + 1
+	opReply
+
+	opEnableScorer
+	opDisableScorer
+	opSetAlphaBeta
+	opAddHotWord
+	opEraseHotWord
+	opClearHotWords
+	opSetBeamWidth
+	opInfo
+	opSpeechToText
+	opCreateStream
+	opClose
+
+	opFree
+	opFeed
+	opDecode
+	opDecodeMetadata
+	opFinish
+	opFinishMetadata
+)
+
+// Error kinds in replies.
+const (
+	errNone uint8 = iota
+	errCode
+	errClosed
+	errOpenStreams
+	errUnsupported
+	errTooManyStreams
+	errMessage
+)
+
+var errFrameTooLarge = errors.New("deepspeech: subprocess frame too large")
+
+type frame struct {
+	op      op
+	id      uint64
+	payload []byte
+}
+
+func writeFrame(w io.Writer, f frame) error {
+	buf := make([]byte, 4+headerSize, 4+headerSize+len(f.payload))
+	binary.LittleEndian.PutUint32(buf, uint32(headerSize+len(f.payload)))
+	buf[4] = byte(f.op)
+	binary.LittleEndian.PutUint64(buf[5:], f.id)
+	_, err := w.Write(append(buf, f.payload...))
+	return err
+}
+
+func readFrame(r io.Reader) (frame, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return frame{}, err
+	}
+	n := binary.LittleEndian.Uint32(length[:])
+	if n < headerSize || n > maxFrame {
+		return frame{}, errFrameTooLarge
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return frame{}, err
+	}
+	return frame{
+		op:      op(buf[0]),
+		id:      binary.LittleEndian.Uint64(buf[1:]),
+		payload: buf[headerSize:],
+	}, nil
+}
+
+// encoder appends values to a payload.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) u8(v uint8) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *encoder) u32(v uint32) {
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(e.buf[len(e.buf)-4:], v)
+}
+
+func (e *encoder) u64(v uint64) {
+	e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(e.buf[len(e.buf)-8:], v)
+}
+
+func (e *encoder) i64(v int64) {
+	e.u64(uint64(v))
+}
+
+func (e *encoder) f32(v float32) {
+	e.u32(math.Float32bits(v))
+}
+
+func (e *encoder) f64(v float64) {
+	e.u64(math.Float64bits(v))
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.u8(1)
+	} else {
+		e.u8(0)
+	}
+}
+
+func (e *encoder) str(v string) {
+	e.u32(uint32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) samples(v []int16) {
+	e.u32(uint32(len(v)))
+	for _, s := range v {
+		e.buf = append(e.buf, byte(s), byte(uint16(s)>>8))
+	}
+}
+
+func (e *encoder) err(err error) {
+	switch err {
+	case nil:
+		e.u8(errNone)
+	case os.ErrClosed:
+		e.u8(errClosed)
+	case model.ErrOpenStreams:
+		e.u8(errOpenStreams)
+	case model.ErrUnsupported:
+		e.u8(errUnsupported)
+	case model.ErrTooManyStreams:
+		e.u8(errTooManyStreams)
+	default:
+		// Engine errors are distinct int types, see model.ErrorOf.
+		if v := reflect.ValueOf(err); v.Kind() == reflect.Int {
+			e.u8(errCode)
+			e.u32(uint32(v.Int()))
+			return
+		}
+		e.u8(errMessage)
+		e.str(err.Error())
+	}
+}
+
+func (e *encoder) info(info model.Info) {
+	e.i64(int64(info.SampleRate))
+	e.u32(info.BeamWidth)
+	e.bool(info.ScorerEnabled)
+	e.str(info.ScorerPath)
+	e.f32(info.Alpha)
+	e.f32(info.Beta)
+	e.str(info.Version)
+	e.str(info.ModelPath)
+	e.i64(info.ModelSize)
+	e.i64(int64(info.OpenStreams))
+	e.i64(int64(info.AudioFed))
+	e.i64(int64(info.DecodeTime))
+}
+
+func (e *encoder) metadata(mt *model.Metadata) {
+	e.u32(uint32(len(mt.Transcripts)))
+	for _, t := range mt.Transcripts {
+		e.f64(t.Confidence)
+		e.u32(uint32(len(t.Tokens)))
+		for _, token := range t.Tokens {
+			e.str(token.Text)
+			e.i64(int64(token.Timestep))
+			e.f32(token.StartTime)
+		}
+	}
+}
+
+// decoder reads values from a payload. After a short read every value is zero
+// and err is set.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+var errShortPayload = errors.New("deepspeech: short subprocess payload")
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || len(d.buf) < n {
+		d.err = errShortPayload
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) u8() uint8 {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) u32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) u64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) i64() int64 {
+	return int64(d.u64())
+}
+
+func (d *decoder) f32() float32 {
+	return math.Float32frombits(d.u32())
+}
+
+func (d *decoder) f64() float64 {
+	return math.Float64frombits(d.u64())
+}
+
+func (d *decoder) bool() bool {
+	return d.u8() != 0
+}
+
+func (d *decoder) str() string {
+	return string(d.next(int(d.u32())))
+}
+
+func (d *decoder) samples() []int16 {
+	n := int(d.u32())
+	b := d.next(n * 2)
+	if b == nil {
+		return nil
+	}
+	v := make([]int16, n)
+	for i := range v {
+		v[i] = int16(binary.LittleEndian.Uint16(b[i*2:]))
+	}
+	return v
+}
+
+func (d *decoder) error() error {
+	switch d.u8() {
+	case errNone:
+		return nil
+	case errCode:
+		return model.ErrorOf(int(d.u32()))
+	case errClosed:
+		return os.ErrClosed
+	case errOpenStreams:
+		return model.ErrOpenStreams
+	case errUnsupported:
+		return model.ErrUnsupported
+	case errTooManyStreams:
+		return model.ErrTooManyStreams
+	default:
+		return errors.New(d.str())
+	}
+}
+
+func (d *decoder) info() model.Info {
+	return model.Info{
+		SampleRate:    int(d.i64()),
+		BeamWidth:     d.u32(),
+		ScorerEnabled: d.bool(),
+		ScorerPath:    d.str(),
+		Alpha:         d.f32(),
+		Beta:          d.f32(),
+		Version:       d.str(),
+		ModelPath:     d.str(),
+		ModelSize:     d.i64(),
+		OpenStreams:   int(d.i64()),
+		AudioFed:      time.Duration(d.i64()),
+		DecodeTime:    time.Duration(d.i64()),
+	}
+}
+
+func (d *decoder) metadata() *model.Metadata {
+	n := int(d.u32())
+	if d.err != nil {
+		return nil
+	}
+	mt := &model.Metadata{Transcripts: []model.CandidateTranscript{}}
+	for i := 0; i < n && d.err == nil; i++ {
+		t := model.CandidateTranscript{Confidence: d.f64()}
+		tokens := int(d.u32())
+		for j := 0; j < tokens && d.err == nil; j++ {
+			t.Tokens = append(t.Tokens, model.TokenMetadata{
+				Text:      d.str(),
+				Timestep:  int(d.i64()),
+				StartTime: d.f32(),
+			})
+		}
+		mt.Transcripts = append(mt.Transcripts, t)
+	}
+	return mt
+}
@@ -0,0 +1,212 @@
+package subprocess
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// Serve answers the requests read from r with m and writes the replies to w.
+// It returns nil once r is closed or a Close request succeeded. Serve is run
+// by the worker process; requests are handled concurrently.
+func Serve(m model.Model, r io.Reader, w io.Writer) error {
+	s := &server{
+		m:       m,
+		w:       bufio.NewWriter(w),
+		streams: make(map[uint64]model.Stream),
+	}
+	var hello encoder
+	hello.info(m.Info())
+	if err := s.write(frame{op: opHello, payload: hello.buf}); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	br := bufio.NewReader(r)
+	for {
+		f, err := readFrame(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if f.op == opClose {
+			wg.Wait()
+			err = m.Close()
+			var e encoder
+			e.err(err)
+			if werr := s.write(frame{op: opReply, id: f.id, payload: e.buf}); werr != nil {
+				return werr
+			}
+			if err == nil {
+				return nil
+			}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = s.write(frame{op: opReply, id: f.id, payload: s.handle(f)})
+		}()
+	}
+}
+
+type server struct {
+	m model.Model
+
+	w   *bufio.Writer
+	wmu sync.Mutex
+
+	counter uint64
+	streams map[uint64]model.Stream
+	mu      sync.Mutex
+}
+
+func (s *server) write(f frame) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if err := writeFrame(s.w, f); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// handle runs the request f and returns the reply payload.
+func (s *server) handle(f frame) []byte {
+	d := decoder{buf: f.payload}
+	var (
+		err   error
+		text  string
+		id    uint64
+		mt    *model.Metadata
+		info  model.Info
+		reply func(e *encoder)
+	)
+	switch f.op {
+	case opEnableScorer:
+		path, alpha, beta := d.str(), d.f32(), d.f32()
+		if d.err == nil {
+			err = s.m.EnableExternalScorer(path, alpha, beta)
+		}
+	case opDisableScorer:
+		err = s.m.DisableExternalScorer()
+	case opSetAlphaBeta:
+		alpha, beta := d.f32(), d.f32()
+		if d.err == nil {
+			err = s.m.SetScorerAlphaBeta(alpha, beta)
+		}
+	case opAddHotWord:
+		word, boost := d.str(), d.f32()
+		if d.err == nil {
+			err = s.m.AddHotWord(word, boost)
+		}
+	case opEraseHotWord:
+		word := d.str()
+		if d.err == nil {
+			err = s.m.EraseHotWord(word)
+		}
+	case opClearHotWords:
+		err = s.m.ClearHotWords()
+	case opSetBeamWidth:
+		beamWidth := d.u32()
+		if d.err == nil {
+			err = s.m.SetBeamWidth(beamWidth)
+		}
+	case opInfo:
+		info = s.m.Info()
+		reply = func(e *encoder) { e.info(info) }
+	case opSpeechToText:
+		audio := d.samples()
+		if d.err == nil {
+			text, err = s.m.SpeechToText(audio)
+		}
+		reply = func(e *encoder) { e.str(text) }
+	case opCreateStream:
+		id, err = s.createStream()
+		reply = func(e *encoder) { e.u64(id) }
+	case opFree, opFeed, opDecode, opDecodeMetadata, opFinish, opFinishMetadata:
+		sid := d.u64()
+		stream, ok := s.stream(sid)
+		if d.err != nil {
+			break
+		}
+		if !ok {
+			err = os.ErrClosed
+			break
+		}
+		switch f.op {
+		case opFree:
+			if err = stream.Free(); err == nil || err == os.ErrClosed {
+				s.remove(sid)
+			}
+		case opFeed:
+			audio := d.samples()
+			if d.err == nil {
+				err = stream.FeedAudioContent(audio)
+			}
+		case opDecode:
+			text, err = stream.IntermediateDecode()
+			reply = func(e *encoder) { e.str(text) }
+		case opDecodeMetadata:
+			n := d.u32()
+			if d.err == nil {
+				mt, err = stream.IntermediateDecodeWithMetadata(n)
+			}
+			reply = func(e *encoder) { e.metadata(mt) }
+		case opFinish:
+			text, err = stream.FinishStream()
+			s.remove(sid)
+			reply = func(e *encoder) { e.str(text) }
+		case opFinishMetadata:
+			n := d.u32()
+			if d.err == nil {
+				mt, err = stream.FinishStreamWithMetadata(n)
+				s.remove(sid)
+			}
+			reply = func(e *encoder) { e.metadata(mt) }
+		}
+	default:
+		err = fmt.Errorf("deepspeech: unknown subprocess op %d", f.op)
+	}
+	if d.err != nil {
+		err = d.err
+	}
+
+	var e encoder
+	e.err(err)
+	if err == nil && reply != nil {
+		reply(&e)
+	}
+	return e.buf
+}
+
+func (s *server) createStream() (uint64, error) {
+	stream, err := s.m.CreateStream()
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counter++
+	s.streams[s.counter] = stream
+	return s.counter, nil
+}
+
+func (s *server) stream(id uint64) (model.Stream, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream, ok := s.streams[id]
+	return stream, ok
+}
+
+func (s *server) remove(id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, id)
+}
@@ -0,0 +1,253 @@
+package subprocess
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+type stream struct {
+	// Accessed atomically.
+	samples      int64
+	lastActivity int64
+	decodeTime   int64
+
+	model   *Model
+	w       *worker
+	id      uint64
+	remote  uint64
+	created time.Time
+	// queue holds the frames of FeedAsync.
+	queue *model.AsyncFeeder
+
+	// finished is set once the stream was freed, finished or lost in a crash.
+	finished bool
+	mu       sync.Mutex
+}
+
+// touch records activity and n samples fed.
+func (s *stream) touch(n int) {
+	if n > 0 {
+		atomic.AddInt64(&s.samples, int64(n))
+	}
+	atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+}
+
+// measure adds n samples fed and the decode time since start.
+func (s *stream) measure(n int, start time.Time) {
+	d := time.Since(start)
+	atomic.AddInt64(&s.decodeTime, int64(d))
+	s.model.measure(n, d)
+}
+
+func (s *stream) info() model.StreamInfo {
+	s.model.mu.Lock()
+	fed := s.model.fed(atomic.LoadInt64(&s.samples))
+	s.model.mu.Unlock()
+	return model.StreamInfo{
+		ID:           s.id,
+		Created:      s.created,
+		LastActivity: time.Unix(0, atomic.LoadInt64(&s.lastActivity)),
+		AudioFed:     fed,
+		DecodeTime:   time.Duration(atomic.LoadInt64(&s.decodeTime)),
+	}
+}
+
+// call sends a stream request. It returns the worker's crash error the first
+// time the stream is used after a crash, and os.ErrClosed after that. s.mu
+// must be held.
+func (s *stream) call(op op, payload func(e *encoder)) (*decoder, error) {
+	if s.finished {
+		return nil, os.ErrClosed
+	}
+	if err := s.w.failed(); err != nil {
+		s.finish()
+		return nil, err
+	}
+	var e encoder
+	e.u64(s.remote)
+	if payload != nil {
+		payload(&e)
+	}
+	d, err := s.w.call(op, e.buf)
+	if _, crashed := err.(*CrashError); crashed {
+		s.finish()
+	}
+	return d, err
+}
+
+// finish forgets the stream. s.mu must be held.
+func (s *stream) finish() {
+	s.finished = true
+	s.queue.Close()
+	s.model.removeStream(s)
+}
+
+func (s *stream) Free() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.free()
+}
+
+// free frees the stream. s.mu must be held.
+func (s *stream) free() error {
+	_, err := s.call(opFree, nil)
+	if err == nil || err == os.ErrClosed {
+		s.finish()
+	}
+	return err
+}
+
+func (s *stream) tracked() model.TrackedStream {
+	return model.TrackedStream{Info: s.info, FreeInactive: s.freeInactive}
+}
+
+// freeInactive frees the stream if it had no activity after cutoff.
+func (s *stream) freeInactive(cutoff time.Time) (model.StreamInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished || atomic.LoadInt64(&s.lastActivity) > cutoff.UnixNano() {
+		return model.StreamInfo{}, false
+	}
+	info := s.info()
+	_ = s.free()
+	s.finish()
+	return info, true
+}
+
+func (s *stream) FeedAudioContent(frame []int16) error {
+	_ = s.queue.Flush()
+	return s.feed(frame)
+}
+
+// feed feeds frame without waiting for the FeedAsync queue. Frames of more
+// than MaxSamples samples are sent in parts.
+func (s *stream) feed(frame []int16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.measure(len(frame), time.Now())
+	for {
+		part := frame
+		if len(part) > MaxSamples {
+			part = part[:MaxSamples]
+		}
+		if _, err := s.call(opFeed, func(e *encoder) { e.samples(part) }); err != nil {
+			return err
+		}
+		s.touch(len(part))
+		if frame = frame[len(part):]; len(frame) == 0 {
+			return nil
+		}
+	}
+}
+
+func (s *stream) IntermediateDecode() (string, error) {
+	_ = s.queue.Flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.measure(0, time.Now())
+	d, err := s.call(opDecode, nil)
+	if err != nil {
+		return "", err
+	}
+	s.touch(0)
+	text := d.str()
+	return text, d.err
+}
+
+func (s *stream) IntermediateDecodeWithMetadata(aNumResults uint32) (*model.Metadata, error) {
+	_ = s.queue.Flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.measure(0, time.Now())
+	d, err := s.call(opDecodeMetadata, func(e *encoder) { e.u32(aNumResults) })
+	if err != nil {
+		return nil, err
+	}
+	s.touch(0)
+	mt := d.metadata()
+	return mt, d.err
+}
+
+func (s *stream) FinishStream() (string, error) {
+	_ = s.queue.Flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.measure(0, time.Now())
+	d, err := s.call(opFinish, nil)
+	if s.finished {
+		return "", err
+	}
+	s.finish()
+	if err != nil {
+		return "", err
+	}
+	text := d.str()
+	return text, d.err
+}
+
+func (s *stream) FinishStreamWithMetadata(aNumResults uint32) (*model.Metadata, error) {
+	_ = s.queue.Flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.finishWithMetadata(aNumResults)
+}
+
+func (s *stream) FinishStreamWithBestHypothesis(aNumResults uint32) (*model.HypothesisCandidate, error) {
+	_ = s.queue.Flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mt, err := s.finishWithMetadata(aNumResults)
+	if err != nil {
+		return nil, err
+	}
+
+	hyp := model.NewHypothesis(mt)
+	if len(hyp.Candidates) == 0 {
+		return nil, nil
+	}
+	best := hyp.Candidates[0]
+	return &best, nil
+}
+
+func (s *stream) FinishStreamWithHypothesis(aNumResults uint32) (model.Hypothesis, error) {
+	_ = s.queue.Flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mt, err := s.finishWithMetadata(aNumResults)
+	if err != nil {
+		return model.Hypothesis{}, err
+	}
+	return model.NewHypothesis(mt), nil
+}
+
+// finishWithMetadata finishes the stream. s.mu must be held.
+func (s *stream) finishWithMetadata(aNumResults uint32) (*model.Metadata, error) {
+	defer s.measure(0, time.Now())
+	d, err := s.call(opFinishMetadata, func(e *encoder) { e.u32(aNumResults) })
+	if s.finished {
+		return nil, err
+	}
+	// The worker finishes the stream even when it fails.
+	s.finish()
+	if err != nil {
+		return nil, err
+	}
+	mt := d.metadata()
+	return mt, d.err
+}
+
+func (s *stream) FeedAsync(frame []int16) error {
+	return s.queue.Feed(frame)
+}
+
+func (s *stream) Flush() error {
+	return s.queue.Flush()
+}
+
+func (s *stream) QueueStats() model.QueueStats {
+	return s.queue.Stats()
+}
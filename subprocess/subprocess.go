@@ -0,0 +1,84 @@
+// Package subprocess runs the engine in a worker process, so a crash inside
+// libdeepspeech only fails the calls and streams of that process instead of
+// the whole server.
+//
+// Model implements model.Model by sending every call over a framed binary
+// protocol to the worker, started from Config.Command, over its stdin and
+// stdout or a Unix socket. The worker runs Serve, see cmd/deepspeech-worker.
+// When the worker dies, calls in progress and open streams fail with a
+// *CrashError and the worker is restarted with the scorer, beam width and hot
+// words set through Model.
+package subprocess
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// Config configures the worker process.
+type Config struct {
+	// Command is the worker executable and Args its arguments, e.g.
+	// deepspeech-worker -model path.
+	Command string
+	Args    []string
+	// Env is the worker environment. A nil Env inherits the environment.
+	Env []string
+	// Stderr receives the worker's standard error. Defaults to os.Stderr.
+	Stderr io.Writer
+
+	// Socket connects to the worker over a Unix socket instead of its stdin
+	// and stdout. The socket path is passed as "-socket path" after Args.
+	Socket bool
+
+	// StartTimeout bounds starting the worker and opening its model.
+	// Defaults to one minute.
+	StartTimeout time.Duration
+	// RestartDelay is the delay before restarting a crashed worker, doubled
+	// after every failed restart up to MaxRestartDelay. Defaults to 100ms and
+	// 10s.
+	RestartDelay    time.Duration
+	MaxRestartDelay time.Duration
+	// CallTimeout bounds every call to the worker, including a decode. A
+	// worker that does not reply in time is killed and restarted as if it
+	// crashed. Defaults to one minute.
+	CallTimeout time.Duration
+	// CloseTimeout is how long Close waits for the worker to exit before
+	// killing it. Defaults to 5s.
+	CloseTimeout time.Duration
+
+	// Report, if not nil, is called with every crash and failed restart.
+	Report func(error)
+}
+
+// Start starts the worker and returns once its model is open.
+func Start(ctx context.Context, config Config) (*Model, error) {
+	if config.Stderr == nil {
+		config.Stderr = os.Stderr
+	}
+	if config.StartTimeout <= 0 {
+		config.StartTimeout = time.Minute
+	}
+	if config.RestartDelay <= 0 {
+		config.RestartDelay = 100 * time.Millisecond
+	}
+	if config.MaxRestartDelay < config.RestartDelay {
+		config.MaxRestartDelay = 10 * time.Second
+		if config.MaxRestartDelay < config.RestartDelay {
+			config.MaxRestartDelay = config.RestartDelay
+		}
+	}
+	if config.CallTimeout <= 0 {
+		config.CallTimeout = time.Minute
+	}
+	if config.CloseTimeout <= 0 {
+		config.CloseTimeout = 5 * time.Second
+	}
+
+	w, err := startWorker(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return newModel(config, w), nil
+}
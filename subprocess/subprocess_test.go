@@ -0,0 +1,244 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/deepspeechtest"
+	"github.com/mologix-co/deepspeech-go/model"
+	"github.com/mologix-co/deepspeech-go/model/modeltest"
+)
+
+// workerEnv makes the test binary run as a worker serving a fake model.
+const workerEnv = "DEEPSPEECH_SUBPROCESS_TEST_WORKER"
+
+// crashSamples is the audio length at which the fake worker exits, and
+// hangSamples the one at which it stops replying.
+const (
+	crashSamples = 1234
+	hangSamples  = 4321
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(workerEnv) != "" {
+		if err := serveFake(os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func serveFake(args []string) error {
+	fake := deepspeechtest.New(deepspeechtest.Config{}).Transcribe(func(audio []int16) []deepspeechtest.Candidate {
+		switch len(audio) {
+		case crashSamples:
+			os.Exit(3)
+		case hangSamples:
+			select {}
+		}
+		return []deepspeechtest.Candidate{{Text: "hello world"}}
+	})
+	if err := fake.EnableExternalScorer("test.scorer", model.LMAlpha, model.LMBeta); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	var w io.Writer = os.Stdout
+	for i, arg := range args {
+		if arg == "-socket" && i+1 < len(args) {
+			conn, err := net.Dial("unix", args[i+1])
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			r, w = conn, conn
+		}
+	}
+	return Serve(fake, r, w)
+}
+
+func start(t *testing.T, socket bool, report func(error)) *Model {
+	return startConfig(t, Config{Socket: socket, Report: report})
+}
+
+// startConfig starts the fake worker with config.
+func startConfig(t *testing.T, config Config) *Model {
+	config.Command = os.Args[0]
+	config.Args = []string{"-test.run=^$"}
+	// The race detector otherwise delays the worker's exit by a second.
+	config.Env = append(os.Environ(), workerEnv+"=1", "GORACE=atexit_sleep_ms=0")
+	config.RestartDelay = 10 * time.Millisecond
+	m, err := Start(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestModel_Conformance(t *testing.T) {
+	modeltest.Run(t, func(t *testing.T) model.Model {
+		return start(t, false, nil)
+	})
+}
+
+func TestModel_ConformanceSocket(t *testing.T) {
+	modeltest.Run(t, func(t *testing.T) model.Model {
+		return start(t, true, nil)
+	})
+}
+
+func TestModel_Crash(t *testing.T) {
+	var (
+		reported []error
+		mu       sync.Mutex
+	)
+	m := start(t, false, func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, err)
+	})
+	if err := m.SetBeamWidth(100); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddHotWord("hello", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DisableExternalScorer(); err != nil {
+		t.Fatal(err)
+	}
+
+	idle, err := m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.FeedAudioContent(make([]int16, crashSamples)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.IntermediateDecode()
+	var crash *CrashError
+	if !errors.As(err, &crash) {
+		t.Fatalf("expected a CrashError, got %v", err)
+	}
+	if _, err = s.IntermediateDecode(); err != os.ErrClosed {
+		t.Fatalf("expected os.ErrClosed after the crash, got %v", err)
+	}
+	if err = idle.FeedAudioContent(make([]int16, 160)); !errors.As(err, &crash) {
+		t.Fatalf("expected a CrashError for the open stream, got %v", err)
+	}
+
+	// CreateStream waits for the restarted worker.
+	s, err = m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.FeedAudioContent(make([]int16, 160)); err != nil {
+		t.Fatal(err)
+	}
+	if text, err := s.FinishStream(); err != nil || text != "hello world" {
+		t.Fatalf("FinishStream after restart = %q, %v", text, err)
+	}
+	if beamWidth := m.Info().BeamWidth; beamWidth != 100 {
+		t.Fatalf("expected the beam width to be restored, got %d", beamWidth)
+	}
+	if info := m.Info(); info.ScorerEnabled {
+		t.Fatal("expected the scorer to stay disabled after the restart")
+	}
+	if err = m.EnableExternalScorer("test.scorer", model.LMAlpha, model.LMBeta); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.AddHotWord("hello", 5); err != model.ErrFailInsertHotWord {
+		t.Fatalf("expected the hot word to be restored, got %v", err)
+	}
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 1 || !errors.As(reported[0], &crash) {
+		t.Fatalf("expected one reported crash, got %v", reported)
+	}
+}
+
+func TestModel_Hang(t *testing.T) {
+	m := startConfig(t, Config{CallTimeout: 200 * time.Millisecond})
+	defer m.Close()
+	if err := m.SetBeamWidth(100); err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.FeedAudioContent(make([]int16, hangSamples)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Settings are read while the worker hangs.
+	decoded := make(chan error, 1)
+	go func() {
+		_, err := s.IntermediateDecode()
+		decoded <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if beamWidth := m.BeamWidth(); beamWidth != 100 {
+		t.Fatalf("BeamWidth = %d, want 100", beamWidth)
+	}
+	if info := m.Info(); info.OpenStreams != 1 || info.BeamWidth != 100 || info.ScorerPath != "test.scorer" {
+		t.Fatalf("Info while the worker hangs = %+v", info)
+	}
+
+	var crash *CrashError
+	if err = <-decoded; !errors.As(err, &crash) || crash.Err != errCallTimeout {
+		t.Fatalf("expected a timeout CrashError, got %v", err)
+	}
+	s, err = m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, err := s.FinishStream(); err != nil || text != "hello world" {
+		t.Fatalf("FinishStream after restart = %q, %v", text, err)
+	}
+	if beamWidth := m.Info().BeamWidth; beamWidth != 100 {
+		t.Fatalf("expected the beam width to be restored, got %d", beamWidth)
+	}
+}
+
+func TestModel_TooLarge(t *testing.T) {
+	m := start(t, false, nil)
+	defer m.Close()
+	if _, err := m.SpeechToText(make([]int16, MaxSamples+1)); err != ErrTooLarge {
+		t.Fatalf("SpeechToText over MaxSamples = %v, want ErrTooLarge", err)
+	}
+	if text, err := m.SpeechToText(make([]int16, 160)); err != nil || text != "hello world" {
+		t.Fatalf("SpeechToText after ErrTooLarge = %q, %v", text, err)
+	}
+
+	// Streams split large frames.
+	s, err := m.CreateStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.FeedAudioContent(make([]int16, MaxSamples+1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.FinishStream(); err != nil {
+		t.Fatal(err)
+	}
+	if fed, want := m.Info().AudioFed, time.Duration(MaxSamples+1+160)*time.Second/16000; fed != want {
+		t.Fatalf("AudioFed = %v, want %v", fed, want)
+	}
+}
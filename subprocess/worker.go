@@ -0,0 +1,369 @@
+package subprocess
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mologix-co/deepspeech-go/model"
+)
+
+// CrashError is returned by calls in progress, and by streams that were open,
+// when the worker process exits or its connection breaks. The worker is
+// restarted; its streams are lost.
+type CrashError struct {
+	// Err is the exit status or the connection error.
+	Err error
+}
+
+func (e *CrashError) Error() string {
+	return "deepspeech: worker crashed: " + e.Err.Error()
+}
+
+func (e *CrashError) Unwrap() error {
+	return e.Err
+}
+
+// errWorkerExited is the crash cause of a worker that exited cleanly without
+// being asked to.
+var errWorkerExited = errors.New("worker exited")
+
+// errCallTimeout is the crash cause of a worker that did not reply within
+// Config.CallTimeout.
+var errCallTimeout = errors.New("worker did not reply in time")
+
+// worker is one worker process and its connection.
+type worker struct {
+	cmd  *exec.Cmd
+	conn io.ReadWriteCloser
+	info model.Info
+	// timeout bounds every call.
+	timeout time.Duration
+
+	w   *bufio.Writer
+	wmu sync.Mutex
+
+	// exited is closed once the process was waited for, with its status in
+	// waitErr.
+	exited  chan struct{}
+	waitErr error
+
+	nextID  uint64
+	pending map[uint64]chan frame
+	// closing is set by Close, so the end of the connection is not a crash.
+	closing bool
+	// failing is set by the first fail.
+	failing bool
+	err     error
+	dead    chan struct{}
+	mu      sync.Mutex
+}
+
+// pipeConn joins the worker's stdout and stdin.
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+	r io.Closer
+}
+
+func (c pipeConn) Close() error {
+	c.WriteCloser.Close()
+	return c.r.Close()
+}
+
+// startWorker starts the worker process and waits for its model to open.
+func startWorker(ctx context.Context, config Config) (*worker, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.StartTimeout)
+	defer cancel()
+
+	args := append([]string(nil), config.Args...)
+	var ln net.Listener
+	if config.Socket {
+		dir, err := ioutil.TempDir("", "deepspeech-worker")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "worker.sock")
+		if ln, err = net.Listen("unix", path); err != nil {
+			return nil, err
+		}
+		defer ln.Close()
+		args = append(args, "-socket", path)
+	}
+
+	cmd := exec.Command(config.Command, args...)
+	cmd.Env = config.Env
+	cmd.Stderr = config.Stderr
+	var conn io.ReadWriteCloser
+	var childFiles []*os.File
+	if !config.Socket {
+		// Plain pipes rather than cmd.StdinPipe, so Wait does not close
+		// them before the last reply is read.
+		stdinR, stdinW, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		stdoutR, stdoutW, err := os.Pipe()
+		if err != nil {
+			stdinR.Close()
+			stdinW.Close()
+			return nil, err
+		}
+		cmd.Stdin, cmd.Stdout = stdinR, stdoutW
+		childFiles = []*os.File{stdinR, stdoutW}
+		conn = pipeConn{Reader: stdoutR, WriteCloser: stdinW, r: stdoutR}
+	}
+	err := cmd.Start()
+	for _, f := range childFiles {
+		f.Close()
+	}
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, err
+	}
+
+	w := &worker{
+		cmd:     cmd,
+		timeout: config.CallTimeout,
+		exited:  make(chan struct{}),
+		pending: make(map[uint64]chan frame),
+		dead:    make(chan struct{}),
+	}
+	go func() {
+		w.waitErr = cmd.Wait()
+		close(w.exited)
+	}()
+
+	type result struct {
+		conn io.ReadWriteCloser
+		info model.Info
+		err  error
+	}
+	done := make(chan result, 1)
+	go func(conn io.ReadWriteCloser) {
+		if ln != nil {
+			c, err := ln.Accept()
+			if err != nil {
+				done <- result{err: err}
+				return
+			}
+			conn = c
+		}
+		info, err := hello(conn)
+		done <- result{conn, info, err}
+	}(conn)
+
+	var r result
+	received := true
+	select {
+	case r = <-done:
+	case <-w.exited:
+		r.err, received = &CrashError{Err: exitError(w.waitErr)}, false
+	case <-ctx.Done():
+		r.err, received = ctx.Err(), false
+	}
+	if r.err != nil {
+		_ = cmd.Process.Kill()
+		if ln != nil {
+			ln.Close()
+		}
+		if conn != nil {
+			conn.Close()
+		}
+		if !received {
+			r = <-done
+		}
+		if r.conn != nil {
+			r.conn.Close()
+		}
+		<-w.exited
+		return nil, r.err
+	}
+
+	w.conn = r.conn
+	w.info = r.info
+	w.w = bufio.NewWriter(r.conn)
+	go w.read(bufio.NewReader(r.conn))
+	return w, nil
+}
+
+// hello reads the worker's first frame.
+func hello(conn io.Reader) (model.Info, error) {
+	f, err := readFrame(conn)
+	if err != nil {
+		return model.Info{}, err
+	}
+	if f.op != opHello {
+		return model.Info{}, errors.New("deepspeech: unexpected first frame from worker")
+	}
+	d := decoder{buf: f.payload}
+	info := d.info()
+	return info, d.err
+}
+
+func exitError(err error) error {
+	if err == nil {
+		return errWorkerExited
+	}
+	return err
+}
+
+// read delivers replies until the connection ends.
+func (w *worker) read(r *bufio.Reader) {
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			w.fail(err)
+			return
+		}
+		w.mu.Lock()
+		ch, ok := w.pending[f.id]
+		delete(w.pending, f.id)
+		w.mu.Unlock()
+		if ok {
+			ch <- f
+		}
+	}
+}
+
+// fail ends the worker after a connection error or errCallTimeout. Calls in
+// progress return a CrashError, or os.ErrClosed if the worker is closing.
+func (w *worker) fail(err error) {
+	w.mu.Lock()
+	if w.failing {
+		w.mu.Unlock()
+		return
+	}
+	w.failing = true
+	closing := w.closing
+	w.mu.Unlock()
+
+	if !closing {
+		if err == errCallTimeout {
+			// The worker hangs; it is not waited for.
+			_ = w.cmd.Process.Kill()
+		} else {
+			// Prefer the exit status, which says why the connection ended.
+			select {
+			case <-w.exited:
+				err = exitError(w.waitErr)
+			case <-time.After(time.Second):
+				_ = w.cmd.Process.Kill()
+			}
+		}
+		err = &CrashError{Err: err}
+	} else {
+		err = os.ErrClosed
+	}
+	w.conn.Close()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.err = err
+	for id, ch := range w.pending {
+		close(ch)
+		delete(w.pending, id)
+	}
+	close(w.dead)
+}
+
+// failed returns the error the worker ended with, or nil while it runs.
+func (w *worker) failed() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// call sends a request and waits for the reply. It returns the reply's error,
+// or a CrashError if the worker ends first or does not reply within w.timeout.
+func (w *worker) call(op op, payload []byte) (*decoder, error) {
+	if headerSize+len(payload) > maxFrame {
+		return nil, ErrTooLarge
+	}
+	ch := make(chan frame, 1)
+	w.mu.Lock()
+	if w.err != nil {
+		w.mu.Unlock()
+		return nil, w.err
+	}
+	w.nextID++
+	id := w.nextID
+	w.pending[id] = ch
+	w.mu.Unlock()
+
+	w.wmu.Lock()
+	err := writeFrame(w.w, frame{op: op, id: id, payload: payload})
+	if err == nil {
+		err = w.w.Flush()
+	}
+	w.wmu.Unlock()
+	if err != nil {
+		w.fail(err)
+	}
+
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	var f frame
+	var ok bool
+	select {
+	case f, ok = <-ch:
+	case <-timer.C:
+		w.fail(errCallTimeout)
+	}
+	if !ok {
+		<-w.dead
+		return nil, w.failed()
+	}
+	d := &decoder{buf: f.payload}
+	if err = d.error(); err != nil {
+		return nil, err
+	}
+	return d, d.err
+}
+
+// close asks the worker to close its model and exit. The process is killed if
+// it does not exit within timeout.
+func (w *worker) close(timeout time.Duration) error {
+	w.mu.Lock()
+	w.closing = true
+	w.mu.Unlock()
+
+	_, err := w.call(opClose, nil)
+	if err != nil && err != os.ErrClosed {
+		if _, crashed := err.(*CrashError); !crashed {
+			// The worker refused, e.g. with open streams.
+			w.mu.Lock()
+			w.closing = false
+			w.mu.Unlock()
+			return err
+		}
+	}
+	w.kill(timeout)
+	return nil
+}
+
+// kill waits up to timeout for the process to exit and kills it otherwise.
+func (w *worker) kill(timeout time.Duration) {
+	w.mu.Lock()
+	w.closing = true
+	w.mu.Unlock()
+	w.conn.Close()
+	select {
+	case <-w.exited:
+	case <-time.After(timeout):
+		_ = w.cmd.Process.Kill()
+		<-w.exited
+	}
+	<-w.dead
+}